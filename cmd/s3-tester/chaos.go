@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/mxcd/tester-toolbox/internal/chaos_proxy"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// getUpstreamURL builds the URL of the configured S3 endpoint.
+func getUpstreamURL(c *cli.Context) *url.URL {
+	S3_ENDPOINT := c.String("endpoint")
+	S3_PORT := c.Int("port")
+	if S3_ENDPOINT == "" {
+		log.Fatal().Msg("Please specify an S3 endpoint")
+	}
+	if S3_PORT == 0 {
+		log.Fatal().Msg("Please specify an S3 port")
+	}
+	scheme := "https"
+	if c.Bool("insecure") {
+		scheme = "http"
+	}
+	return &url.URL{Scheme: scheme, Host: fmt.Sprintf("%s:%d", S3_ENDPOINT, S3_PORT)}
+}
+
+func chaosProxy(c *cli.Context) error {
+	options := chaos_proxy.Options{
+		Upstream:     getUpstreamURL(c),
+		Latency:      c.Duration("latency"),
+		Jitter:       c.Duration("jitter"),
+		SlowDownRate: c.Float64("slowdown-rate"),
+		ResetRate:    c.Float64("reset-rate"),
+		TruncateRate: c.Float64("truncate-rate"),
+	}
+	if bandwidth := c.String("bandwidth"); bandwidth != "" {
+		var err error
+		options.Bandwidth, err = util.GetByteSizeFromString(bandwidth)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Invalid bandwidth '%s'", bandwidth)
+		}
+	}
+	err := options.Validate()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid chaos proxy options")
+	}
+
+	bandwidth := "unlimited"
+	if options.Bandwidth > 0 {
+		bandwidth = util.GetStringFromByteSize(options.Bandwidth) + "/s"
+	}
+	log.Info().Msgf("Injecting %s latency with %s jitter, %s bandwidth, %.1f%% slowdowns, %.1f%% resets and %.1f%% truncations", options.Latency, options.Jitter, bandwidth, options.SlowDownRate*100, options.ResetRate*100, options.TruncateRate*100)
+	return chaos_proxy.StartProxy(c.String("listen"), options)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mxcd/tester-toolbox/internal/chaos_proxy"
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+)
+
+func TestPerformanceThroughChaosProxy(t *testing.T) {
+	useFastRetries(t)
+	upstream, _ := url.Parse(newMockServer(t, s3mock_server.Options{}).URL)
+	proxy, err := chaos_proxy.NewProxy(chaos_proxy.Options{
+		Upstream:     upstream,
+		SlowDownRate: 0.1,
+		ResetRate:    0.1,
+		TruncateRate: 0.1,
+		Seed:         1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %s", err)
+	}
+	proxyServer := httptest.NewServer(proxy)
+	t.Cleanup(proxyServer.Close)
+
+	target := newTestTarget(t, proxyServer.URL)
+	config := performanceConfig{VUs: 2, Duration: 1, FileSize: "16KiB", Payload: "random", Verify: true}
+	results := runMockPerformance(t, target, config)
+
+	stats := proxy.Stats()
+	if stats.SlowDowns == 0 || stats.Resets == 0 || stats.Truncations == 0 {
+		t.Fatalf("Expected all kinds of faults to be injected but got %+v", stats)
+	}
+	if results.Upload.Throttled == 0 {
+		t.Errorf("Expected injected slowdowns to show up as throttled uploads")
+	}
+	if results.Upload.Attempts.Max < 2 {
+		t.Errorf("Expected resets and slowdowns to be retried")
+	}
+	if results.Upload.Successes != results.Upload.Operations {
+		t.Errorf("Expected retries to recover all %d uploads but %d succeeded", results.Upload.Operations, results.Upload.Successes)
+	}
+	if results.Download.Successes == results.Download.Operations {
+		t.Errorf("Expected truncated downloads to fail verification")
+	}
+}
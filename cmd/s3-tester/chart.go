@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	chartWidth        = 760
+	chartHeight       = 320
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 50
+	chartMarginBottom = 50
+)
+
+type chartPoint struct {
+	x float64
+	y float64
+}
+
+type chartSeries struct {
+	name   string
+	color  string
+	dashed bool
+	points []chartPoint
+}
+
+type chartAxis struct {
+	label string
+	// logarithmic axes skip values of zero and below
+	logarithmic bool
+}
+
+// chartScale maps values of an axis to pixels.
+type chartScale struct {
+	min         float64
+	max         float64
+	logarithmic bool
+	from        float64
+	to          float64
+}
+
+func (s chartScale) position(value float64) float64 {
+	min, max := s.min, s.max
+	if s.logarithmic {
+		value, min, max = math.Log10(value), math.Log10(min), math.Log10(max)
+	}
+	return s.from + (value-min)/(max-min)*(s.to-s.from)
+}
+
+func (s chartScale) ticks() []float64 {
+	if !s.logarithmic {
+		return linearTicks(s.min, s.max, 6)
+	}
+	ticks := make([]float64, 0)
+	for exponent := math.Floor(math.Log10(s.min)); exponent <= math.Ceil(math.Log10(s.max)); exponent++ {
+		for _, factor := range []float64{1, 2, 5} {
+			tick := factor * math.Pow(10, exponent)
+			if tick >= s.min && tick <= s.max {
+				ticks = append(ticks, tick)
+			}
+		}
+	}
+	return ticks
+}
+
+// linearTicks returns about count ticks at round values between min and max.
+func linearTicks(min float64, max float64, count int) []float64 {
+	rough := (max - min) / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(rough)))
+	step := magnitude
+	for _, factor := range []float64{2, 5, 10} {
+		if step >= rough {
+			break
+		}
+		step = factor * magnitude
+	}
+	ticks := make([]float64, 0, count+1)
+	for tick := math.Ceil(min/step) * step; tick <= max+step/1000; tick += step {
+		ticks = append(ticks, tick)
+	}
+	return ticks
+}
+
+func newChartScale(axis chartAxis, values []float64, from float64, to float64) chartScale {
+	scale := chartScale{min: math.Inf(1), max: math.Inf(-1), logarithmic: axis.logarithmic, from: from, to: to}
+	for _, value := range values {
+		if axis.logarithmic && value <= 0 {
+			continue
+		}
+		scale.min = math.Min(scale.min, value)
+		scale.max = math.Max(scale.max, value)
+	}
+	switch {
+	case math.IsInf(scale.min, 1):
+		scale.min, scale.max = 1, 10
+	case axis.logarithmic:
+		scale.min = math.Pow(10, math.Floor(math.Log10(scale.min)))
+		scale.max = math.Pow(10, math.Ceil(math.Log10(scale.max)))
+		if scale.min == scale.max {
+			scale.max *= 10
+		}
+	default:
+		scale.min = math.Min(scale.min, 0)
+		if scale.max <= scale.min {
+			scale.max = scale.min + 1
+		}
+		ticks := linearTicks(scale.min, scale.max, 6)
+		if last := ticks[len(ticks)-1]; last < scale.max {
+			scale.max = last + (ticks[1] - ticks[0])
+		} else {
+			scale.max = last
+		}
+	}
+	return scale
+}
+
+func formatTick(value float64) string {
+	if math.Abs(value) >= 1 || value == 0 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', 3, 64)
+}
+
+// lineChart renders the series as an SVG line chart with a legend.
+func lineChart(title string, xAxis chartAxis, yAxis chartAxis, series []chartSeries) template.HTML {
+	xValues := make([]float64, 0)
+	yValues := make([]float64, 0)
+	for _, s := range series {
+		for _, point := range s.points {
+			xValues = append(xValues, point.x)
+			yValues = append(yValues, point.y)
+		}
+	}
+	x := newChartScale(xAxis, xValues, chartMarginLeft, chartWidth-chartMarginRight)
+	y := newChartScale(yAxis, yValues, chartHeight-chartMarginBottom, chartMarginTop)
+
+	svg := &strings.Builder{}
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" class="chart">`, chartWidth, chartHeight)
+	fmt.Fprintf(svg, `<text x="%d" y="20" class="title">%s</text>`, chartMarginLeft, template.HTMLEscapeString(title))
+
+	for _, tick := range x.ticks() {
+		position := x.position(tick)
+		fmt.Fprintf(svg, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" class="grid"/>`, position, chartMarginTop, position, chartHeight-chartMarginBottom)
+		fmt.Fprintf(svg, `<text x="%.1f" y="%d" class="tick" text-anchor="middle">%s</text>`, position, chartHeight-chartMarginBottom+16, formatTick(tick))
+	}
+	for _, tick := range y.ticks() {
+		position := y.position(tick)
+		fmt.Fprintf(svg, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" class="grid"/>`, chartMarginLeft, position, chartWidth-chartMarginRight, position)
+		fmt.Fprintf(svg, `<text x="%d" y="%.1f" class="tick" text-anchor="end">%s</text>`, chartMarginLeft-6, position+4, formatTick(tick))
+	}
+	fmt.Fprintf(svg, `<rect x="%d" y="%d" width="%d" height="%d" class="frame"/>`, chartMarginLeft, chartMarginTop, chartWidth-chartMarginLeft-chartMarginRight, chartHeight-chartMarginTop-chartMarginBottom)
+	fmt.Fprintf(svg, `<text x="%d" y="%d" class="label" text-anchor="middle">%s</text>`, (chartWidth+chartMarginLeft-chartMarginRight)/2, chartHeight-10, template.HTMLEscapeString(xAxis.label))
+	fmt.Fprintf(svg, `<text x="16" y="%d" class="label" text-anchor="middle" transform="rotate(-90 16 %d)">%s</text>`, (chartHeight+chartMarginTop-chartMarginBottom)/2, (chartHeight+chartMarginTop-chartMarginBottom)/2, template.HTMLEscapeString(yAxis.label))
+
+	legend := chartWidth - chartMarginRight
+	for i := len(series) - 1; i >= 0; i-- {
+		s := series[i]
+		legend -= 14 + 7*len(s.name) + 16
+		dash := ""
+		if s.dashed {
+			dash = ` stroke-dasharray="4 3"`
+		}
+		fmt.Fprintf(svg, `<line x1="%d" y1="36" x2="%d" y2="36" stroke="%s" stroke-width="2"%s/>`, legend, legend+14, s.color, dash)
+		fmt.Fprintf(svg, `<text x="%d" y="40" class="tick">%s</text>`, legend+18, template.HTMLEscapeString(s.name))
+
+		points := make([]string, 0, len(s.points))
+		for _, point := range s.points {
+			if (xAxis.logarithmic && point.x <= 0) || (yAxis.logarithmic && point.y <= 0) {
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x.position(point.x), y.position(point.y)))
+		}
+		fmt.Fprintf(svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"%s/>`, strings.Join(points, " "), s.color, dash)
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	comparisonUnchanged      = "ok"
+	comparisonRegression     = "REGRESSION"
+	comparisonImprovement    = "improvement"
+	comparisonNotSignificant = "not significant"
+)
+
+// comparisonMetric is a metric of one operation that compare reports.
+type comparisonMetric struct {
+	name           string
+	higherIsBetter bool
+	// percentagePoints metrics are compared by their absolute difference
+	percentagePoints bool
+	value            func(report *performanceReport, results *operationResults) float64
+	// histogram returns the samples for the significance test, if there are any
+	histogram func(results *operationResults) *util.Histogram
+}
+
+func timesHistogram(results *operationResults) *util.Histogram  { return &results.Times }
+func speedsHistogram(results *operationResults) *util.Histogram { return &results.Speeds }
+
+var comparisonMetrics = []comparisonMetric{
+	{name: "P50 [ms]", histogram: timesHistogram, value: func(_ *performanceReport, r *operationResults) float64 { return r.Times.Percentile(50) }},
+	{name: "P90 [ms]", histogram: timesHistogram, value: func(_ *performanceReport, r *operationResults) float64 { return r.Times.Percentile(90) }},
+	{name: "P99 [ms]", histogram: timesHistogram, value: func(_ *performanceReport, r *operationResults) float64 { return r.Times.Percentile(99) }},
+	{name: "Mean [ms]", histogram: timesHistogram, value: func(_ *performanceReport, r *operationResults) float64 { return r.Times.Mean() }},
+	{name: "Mean [MB/s]", higherIsBetter: true, histogram: speedsHistogram, value: func(_ *performanceReport, r *operationResults) float64 { return r.Speeds.Mean() / 1000000 }},
+	{name: "Throughput [ops/s]", higherIsBetter: true, value: func(report *performanceReport, r *operationResults) float64 { return report.throughput(r) }},
+	{name: "Errors [%]", percentagePoints: true, value: func(_ *performanceReport, r *operationResults) float64 {
+		return percentage(r.Operations-r.Successes, r.Operations)
+	}},
+}
+
+// comparisonTolerance configures when a change is flagged.
+type comparisonTolerance struct {
+	// Percent is the relative change a metric may get worse by.
+	Percent float64
+	// ErrorPoints is the increase of the error rate in percentage points that is tolerated.
+	ErrorPoints float64
+	// Alpha is the significance level of the Mann-Whitney U test.
+	Alpha float64
+}
+
+type comparison struct {
+	operation string
+	metric    string
+	baseline  float64
+	current   float64
+	change    float64
+	// percentagePoints comparisons have no meaningful relative change
+	percentagePoints bool
+	pValue           float64
+	tested           bool
+	result           string
+}
+
+// compareReports compares every metric of every operation that ran in either
+// report. A metric regresses if it got worse by more than the tolerance and,
+// where samples are available, the change is statistically significant.
+func compareReports(baseline *performanceReport, current *performanceReport, tolerance comparisonTolerance) []comparison {
+	operations := []struct {
+		name      string
+		operation func(set *operationSet) *operationResults
+	}{
+		{"Upload", uploadOperation},
+		{"Download", downloadOperation},
+		{"Delete", deleteOperation},
+	}
+
+	comparisons := make([]comparison, 0)
+	for _, operation := range operations {
+		baselineResults := operation.operation(&baseline.Results.operationSet)
+		currentResults := operation.operation(&current.Results.operationSet)
+		if baselineResults.Operations == 0 && currentResults.Operations == 0 {
+			continue
+		}
+
+		for _, metric := range comparisonMetrics {
+			if metric.histogram != nil && metric.histogram(baselineResults).Count == 0 && metric.histogram(currentResults).Count == 0 {
+				continue
+			}
+			result := comparison{
+				operation: operation.name,
+				metric:    metric.name,
+				baseline:  metric.value(baseline, baselineResults),
+				current:   metric.value(current, currentResults),
+				pValue:    1,
+
+				percentagePoints: metric.percentagePoints,
+			}
+			result.change = relativeChange(result.baseline, result.current)
+
+			significant := true
+			if metric.histogram != nil {
+				_, result.pValue = util.MannWhitneyU(metric.histogram(baselineResults), metric.histogram(currentResults))
+				result.tested = true
+				significant = result.pValue < tolerance.Alpha
+			}
+
+			worse := result.current - result.baseline
+			limit := tolerance.ErrorPoints
+			if !metric.percentagePoints {
+				worse = result.change
+				limit = tolerance.Percent
+			}
+			if metric.higherIsBetter {
+				worse = -worse
+			}
+
+			switch {
+			case worse > limit && significant:
+				result.result = comparisonRegression
+			case worse > limit:
+				result.result = comparisonNotSignificant
+			case -worse > limit && significant:
+				result.result = comparisonImprovement
+			default:
+				result.result = comparisonUnchanged
+			}
+			comparisons = append(comparisons, result)
+		}
+	}
+	return comparisons
+}
+
+func compare(c *cli.Context) error {
+	if c.Args().Len() != 2 {
+		log.Fatal().Msg("Please specify a baseline and a current results file")
+	}
+	baseline, err := readPerformanceReport(c.Args().Get(0))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read baseline")
+	}
+	current, err := readPerformanceReport(c.Args().Get(1))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read current results")
+	}
+	if baseline.Config != current.Config {
+		log.Warn().Msgf("The runs used different configurations: baseline %+v, current %+v", baseline.Config, current.Config)
+	}
+
+	tolerance := comparisonTolerance{
+		Percent:     c.Float64("tolerance"),
+		ErrorPoints: c.Float64("error-tolerance"),
+		Alpha:       c.Float64("alpha"),
+	}
+	if tolerance.Percent < 0 || tolerance.ErrorPoints < 0 || tolerance.Alpha <= 0 || tolerance.Alpha >= 1 {
+		log.Fatal().Msg("Tolerances must not be negative and alpha must be between 0 and 1")
+	}
+
+	comparisons := compareReports(baseline, current, tolerance)
+	renderComparisons(comparisons, baseline, current, tolerance)
+
+	regressions := 0
+	for _, comparison := range comparisons {
+		if comparison.result == comparisonRegression {
+			regressions++
+		}
+	}
+	if regressions > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d metrics regressed beyond the tolerance", regressions, len(comparisons)), 1)
+	}
+	log.Info().Msg("No regressions beyond the tolerance")
+	return nil
+}
+
+func renderComparisons(comparisons []comparison, baseline *performanceReport, current *performanceReport, tolerance comparisonTolerance) {
+	t := table.NewWriter()
+	log.Info().Msgf("Baseline started %s, current started %s", baseline.Start.Format(time.RFC3339), current.Start.Format(time.RFC3339))
+	t.SetTitle("S3 Comparison | %.1f%% tolerance | %.1f pp errors | alpha %.2f", tolerance.Percent, tolerance.ErrorPoints, tolerance.Alpha)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Operation", "Metric", "Baseline", "Current", "Delta", "Change [%]", "p-value", "Result"})
+	last := ""
+	for _, comparison := range comparisons {
+		if last != "" && comparison.operation != last {
+			t.AppendSeparator()
+		}
+		last = comparison.operation
+
+		change := "-"
+		if !comparison.percentagePoints {
+			change = fmt.Sprintf("%+.1f", comparison.change)
+		}
+		pValue := "-"
+		if comparison.tested {
+			pValue = fmt.Sprintf("%.4f", comparison.pValue)
+		}
+		t.AppendRow(table.Row{
+			comparison.operation,
+			comparison.metric,
+			fmt.Sprintf("%.2f", comparison.baseline),
+			fmt.Sprintf("%.2f", comparison.current),
+			fmt.Sprintf("%+.2f", comparison.current-comparison.baseline),
+			change,
+			pValue,
+			comparison.result,
+		})
+	}
+	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
+	t.Render()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSyntheticReport records log-normal upload times around median and the
+// given number of failures.
+func newSyntheticReport(seed int64, median float64, failures int) *performanceReport {
+	random := rand.New(rand.NewSource(seed))
+	results := &performanceResults{}
+	for i := 0; i < 1000; i++ {
+		elapsed := time.Duration(math.Exp(random.NormFloat64()*0.3) * median * float64(time.Millisecond))
+		results.Upload.record(elapsed, 1000000, &attemptTracker{requests: map[string]int{}}, nil)
+	}
+	for i := 0; i < failures; i++ {
+		results.Upload.Operations++
+	}
+	return &performanceReport{
+		Start:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Elapsed: 10,
+		Config:  performanceConfig{VUs: 1, Duration: 10, FileSize: "1MB", Payload: "random"},
+		Results: results,
+	}
+}
+
+func comparisonResults(comparisons []comparison) map[string]string {
+	results := make(map[string]string)
+	for _, comparison := range comparisons {
+		results[comparison.operation+" "+comparison.metric] = comparison.result
+	}
+	return results
+}
+
+func TestCompareReports(t *testing.T) {
+	tolerance := comparisonTolerance{Percent: 10, ErrorPoints: 1, Alpha: 0.05}
+	baseline := newSyntheticReport(1, 100, 0)
+
+	unchanged := comparisonResults(compareReports(baseline, newSyntheticReport(2, 100, 0), tolerance))
+	if len(unchanged) != 7 {
+		t.Errorf("Expected 7 upload metrics but got %d", len(unchanged))
+	}
+	for metric, result := range unchanged {
+		if result != comparisonUnchanged {
+			t.Errorf("Expected %s to be unchanged but got %s", metric, result)
+		}
+	}
+
+	slower := comparisonResults(compareReports(baseline, newSyntheticReport(2, 130, 30), tolerance))
+	for _, metric := range []string{"Upload P50 [ms]", "Upload P90 [ms]", "Upload Mean [ms]", "Upload Mean [MB/s]", "Upload Errors [%]"} {
+		if slower[metric] != comparisonRegression {
+			t.Errorf("Expected %s to regress but got %s", metric, slower[metric])
+		}
+	}
+
+	faster := comparisonResults(compareReports(baseline, newSyntheticReport(2, 70, 0), tolerance))
+	if faster["Upload P50 [ms]"] != comparisonImprovement || faster["Upload Mean [MB/s]"] != comparisonImprovement {
+		t.Errorf("Expected improvements but got %v", faster)
+	}
+
+	// a large relative change on very few samples is not significant
+	few := newSyntheticReport(3, 100, 0)
+	few.Results = &performanceResults{}
+	few.Results.Upload.record(150*time.Millisecond, 1000000, &attemptTracker{requests: map[string]int{}}, nil)
+	few.Results.Upload.record(140*time.Millisecond, 1000000, &attemptTracker{requests: map[string]int{}}, nil)
+	if result := comparisonResults(compareReports(baseline, few, tolerance))["Upload P50 [ms]"]; result != comparisonNotSignificant {
+		t.Errorf("Expected a change on 2 samples not to be significant but got %s", result)
+	}
+}
+
+func TestPerformanceReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.json")
+	report := newSyntheticReport(1, 100, 5)
+	err := writePerformanceReport(path, report)
+	if err != nil {
+		t.Fatalf("Failed to write report: %s", err)
+	}
+	read, err := readPerformanceReport(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %s", err)
+	}
+	if read.Config != report.Config || read.Results.Upload.Operations != 1005 || read.Results.Upload.Times.Percentile(50) != report.Results.Upload.Times.Percentile(50) {
+		t.Errorf("Report changed in the round trip")
+	}
+	for _, comparison := range compareReports(report, read, comparisonTolerance{Percent: 0, ErrorPoints: 0, Alpha: 0.05}) {
+		if comparison.result != comparisonUnchanged {
+			t.Errorf("Expected %s %s to be unchanged after the round trip but got %s", comparison.operation, comparison.metric, comparison.result)
+		}
+	}
+
+	_, err = readPerformanceReport(filepath.Join(t.TempDir(), "missing.json"))
+	if err == nil {
+		t.Errorf("Expected an error for a missing report")
+	}
+}
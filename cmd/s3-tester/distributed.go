@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/schollz/progressbar/v3"
+	"github.com/urfave/cli/v2"
+)
+
+// agentRunRequest is sent by the coordinator to start a workload on an agent.
+// The start delay is relative so that clock skew between hosts does not matter.
+type agentRunRequest struct {
+	Config     performanceConfig `json:"config"`
+	StartDelay time.Duration     `json:"startDelay"`
+}
+
+// agentMessage is streamed back by an agent as one JSON object per line.
+type agentMessage struct {
+	Interval *performanceResults `json:"interval,omitempty"`
+	Done     bool                `json:"done,omitempty"`
+}
+
+// agentServer runs workloads on behalf of a coordinator, one at a time.
+type agentServer struct {
+	mutex   sync.Mutex
+	running bool
+	run     func(ctx context.Context, config performanceConfig, onInterval func(interval *performanceResults))
+}
+
+func newAgentServer(target *s3Target) *agentServer {
+	return &agentServer{
+		run: func(ctx context.Context, config performanceConfig, onInterval func(interval *performanceResults)) {
+			runPerformance(ctx, target, config, onInterval)
+		},
+	}
+}
+
+func (a *agentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/run" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request := agentRunRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid run request: %s", err), http.StatusBadRequest)
+		return
+	}
+	err = request.Config.validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mutex.Lock()
+	if a.running {
+		a.mutex.Unlock()
+		http.Error(w, "agent is already running a workload", http.StatusConflict)
+		return
+	}
+	a.running = true
+	a.mutex.Unlock()
+	defer func() {
+		a.mutex.Lock()
+		a.running = false
+		a.mutex.Unlock()
+	}()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	send := func(message agentMessage) {
+		err := encoder.Encode(&message)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to send message to coordinator")
+			return
+		}
+		flusher.Flush()
+	}
+
+	log.Info().Msgf("Starting workload with %d virtual users for %d seconds in %s", request.Config.VUs, request.Config.Duration, request.StartDelay)
+	select {
+	case <-time.After(request.StartDelay):
+	case <-r.Context().Done():
+		log.Warn().Msg("Coordinator disconnected before the workload started")
+		return
+	}
+
+	a.run(r.Context(), request.Config, func(interval *performanceResults) {
+		send(agentMessage{Interval: interval})
+	})
+	send(agentMessage{Done: true})
+	log.Info().Msg("Workload finished")
+}
+
+func agent(c *cli.Context) error {
+	listen := c.String("listen")
+	server := newAgentServer(getS3Target(c))
+	log.Info().Msgf("Agent listening on %s", listen)
+	return http.ListenAndServe(listen, server)
+}
+
+// splitVUs distributes vus as evenly as possible across the given number of agents.
+func splitVUs(vus int, agents int) []int {
+	shares := make([]int, agents)
+	for i := range shares {
+		shares[i] = vus / agents
+		if i < vus%agents {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// coordinate starts the workload on all agents with the VUs of config split
+// between them and hands every interval streamed back by an agent to
+// onInterval. It returns once all agents have finished.
+func coordinate(agents []string, config performanceConfig, startDelay time.Duration, onInterval func(agent string, interval *performanceResults)) error {
+	if config.VUs < len(agents) {
+		return fmt.Errorf("%d virtual users cannot be split across %d agents", config.VUs, len(agents))
+	}
+
+	shares := splitVUs(config.VUs, len(agents))
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(agents))
+	for i, agent := range agents {
+		agentConfig := config
+		agentConfig.VUs = shares[i]
+		wg.Add(1)
+		go func(i int, agent string) {
+			defer wg.Done()
+			errs[i] = runAgent(agent, agentRunRequest{Config: agentConfig, StartDelay: startDelay}, func(interval *performanceResults) {
+				onInterval(agent, interval)
+			})
+			if errs[i] != nil {
+				log.Error().Err(errs[i]).Msgf("Agent '%s' failed", agent)
+			}
+		}(i, agent)
+	}
+	wg.Wait()
+
+	failed := make([]string, 0)
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, agents[i])
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("agents failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runAgent(agent string, request agentRunRequest, onInterval func(interval *performanceResults)) error {
+	body, err := json.Marshal(&request)
+	if err != nil {
+		return err
+	}
+	response, err := http.Post(agentURL(agent)+"/run", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message := new(bytes.Buffer)
+		message.ReadFrom(response.Body)
+		return fmt.Errorf("agent responded with status %d: %s", response.StatusCode, strings.TrimSpace(message.String()))
+	}
+	log.Info().Msgf("Agent '%s' accepted %d virtual users", agent, request.Config.VUs)
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		message := agentMessage{}
+		err := json.Unmarshal(scanner.Bytes(), &message)
+		if err != nil {
+			return fmt.Errorf("invalid message from agent: %w", err)
+		}
+		if message.Interval != nil {
+			onInterval(message.Interval)
+		}
+		if message.Done {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("agent closed the connection before the workload finished")
+}
+
+func agentURL(agent string) string {
+	if strings.HasPrefix(agent, "http://") || strings.HasPrefix(agent, "https://") {
+		return strings.TrimSuffix(agent, "/")
+	}
+	return "http://" + strings.TrimSuffix(agent, "/")
+}
+
+func coordinator(c *cli.Context) error {
+	agents := c.StringSlice("agents")
+	if len(agents) == 0 {
+		log.Fatal().Msg("Please specify at least one agent")
+	}
+	config := getPerformanceConfig(c)
+	sizeDistribution, _ := util.ParseSizeDistribution(config.FileSize)
+
+	log.Info().Msgf("Starting distributed performance test with %d virtual users on %d agents for %d seconds and %s files of %s", config.VUs, len(agents), config.Duration, config.Payload, sizeDistribution)
+
+	logPhases(config)
+
+	mutex := sync.Mutex{}
+	progress := progressbar.Default(-1)
+	// the workload starts on the agents after the start delay
+	delay := c.Duration("start-delay")
+	run := newMeasurement(time.Now().Add(delay), config)
+	err := coordinate(agents, config, delay, func(agent string, interval *performanceResults) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		run.add(interval, time.Now())
+		progress.Add(interval.iterations())
+	})
+	progress.Finish()
+
+	log.Info().Msg("Distributed performance test finished")
+
+	title := fmt.Sprintf("%d VUs on %d agents | %d seconds | %s file size", config.VUs, len(agents), config.Duration, sizeDistribution)
+	renderPerformanceResults(run.results, title, sizeDistribution)
+	run.render()
+
+	writeReports(c, &performanceReport{
+		Start:    run.start,
+		Elapsed:  run.elapsed().Seconds(),
+		Agents:   len(agents),
+		Config:   config,
+		Results:  run.results,
+		Phases:   run.report(),
+		Timeline: run.timeline.points(),
+	})
+	return err
+}
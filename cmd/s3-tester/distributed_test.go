@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newStubAgent starts an agent on loopback that reports one successful
+// iteration per virtual user and interval instead of talking to S3.
+func newStubAgent(t *testing.T, vus *int) *httptest.Server {
+	server := &agentServer{
+		run: func(ctx context.Context, config performanceConfig, onInterval func(interval *performanceResults)) {
+			*vus = config.VUs
+			for i := 0; i < config.Duration; i++ {
+				interval := &performanceResults{}
+				for vu := 0; vu < config.VUs; vu++ {
+					interval.Upload.Operations++
+					interval.Upload.Successes++
+					interval.Upload.Times.Record(float64(10 * (vu + 1)))
+					interval.sizeClass(1024).Upload.Operations++
+				}
+				onInterval(interval)
+			}
+		},
+	}
+	agent := httptest.NewServer(server)
+	t.Cleanup(agent.Close)
+	return agent
+}
+
+func TestCoordinate(t *testing.T) {
+	vus := make([]int, 3)
+	agents := make([]string, 3)
+	for i := range agents {
+		agents[i] = newStubAgent(t, &vus[i]).URL
+	}
+
+	config := performanceConfig{VUs: 7, Duration: 4, FileSize: "1KiB", Payload: "random"}
+	mutex := sync.Mutex{}
+	results := &performanceResults{}
+	intervals := map[string]int{}
+	err := coordinate(agents, config, 10*time.Millisecond, func(agent string, interval *performanceResults) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results.merge(interval)
+		intervals[agent]++
+	})
+	if err != nil {
+		t.Fatalf("Unexpected coordination error: %s", err)
+	}
+
+	if vus[0] != 3 || vus[1] != 2 || vus[2] != 2 {
+		t.Errorf("Expected virtual users split 3/2/2 but got %v", vus)
+	}
+	for _, agent := range agents {
+		if intervals[agent] != 4 {
+			t.Errorf("Expected 4 intervals from agent %s but got %d", agent, intervals[agent])
+		}
+	}
+	if results.Upload.Successes != 28 || results.Upload.Times.Count != 28 {
+		t.Errorf("Expected 28 merged uploads but got %d", results.Upload.Successes)
+	}
+	if results.Upload.Times.Max != 30 {
+		t.Errorf("Expected merged maximum of 30 but got %f", results.Upload.Times.Max)
+	}
+	if results.SizeClasses[1024].Upload.Operations != 28 {
+		t.Errorf("Expected 28 merged uploads in size class 1024 but got %d", results.SizeClasses[1024].Upload.Operations)
+	}
+}
+
+func TestCoordinateFailures(t *testing.T) {
+	var vus int
+	agent := newStubAgent(t, &vus).URL
+	config := performanceConfig{VUs: 1, Duration: 1, FileSize: "1KiB", Payload: "random"}
+	noop := func(agent string, interval *performanceResults) {}
+
+	if err := coordinate([]string{agent, agent}, config, 0, noop); err == nil {
+		t.Errorf("Expected an error when there are fewer virtual users than agents")
+	}
+
+	invalid := config
+	invalid.FileSize = "invalid"
+	invalid.VUs = 2
+	if err := coordinate([]string{agent}, invalid, 0, noop); err == nil {
+		t.Errorf("Expected an error for an invalid configuration")
+	}
+
+	unreachable := httptest.NewServer(nil)
+	unreachable.Close()
+	if err := coordinate([]string{unreachable.URL}, config, 0, noop); err == nil {
+		t.Errorf("Expected an error for an unreachable agent")
+	}
+}
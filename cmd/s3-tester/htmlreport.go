@@ -0,0 +1,294 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+//go:embed report.html
+var htmlReportTemplateSource string
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(htmlReportTemplateSource))
+
+var operationColors = map[string]string{
+	"Upload":   "#1f77b4",
+	"Download": "#ff7f0e",
+	"Delete":   "#2ca02c",
+}
+
+// cdfPercentiles are the percentiles plotted in the latency CDF.
+var cdfPercentiles = []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 40, 50, 60, 70, 80, 90, 95, 98, 99, 99.5, 99.9, 100}
+
+const histogramChartBins = 60
+
+type htmlField struct {
+	Name  string
+	Value string
+}
+
+type htmlTable struct {
+	Title  string
+	Header []string
+	// a nil row separates groups of rows
+	Rows [][]string
+}
+
+type htmlReport struct {
+	Title     string
+	Generated string
+	Fields    []htmlField
+	Charts    []template.HTML
+	Tables    []htmlTable
+}
+
+type reportOperation struct {
+	name      string
+	results   func(set *operationSet) *operationResults
+	timeline  func(point *timelinePoint) *timelineOperation
+	transfers bool
+}
+
+var reportOperations = []reportOperation{
+	{"Upload", uploadOperation, uploadTimeline, true},
+	{"Download", downloadOperation, downloadTimeline, true},
+	{"Delete", deleteOperation, deleteTimeline, false},
+}
+
+// title describes the workload of the report like the console tables do.
+func (r *performanceReport) title() string {
+	sizeDistribution, _ := util.ParseSizeDistribution(r.Config.FileSize)
+	vus := fmt.Sprintf("%d VUs", r.Config.VUs)
+	if r.Agents > 0 {
+		vus = fmt.Sprintf("%d VUs on %d agents", r.Config.VUs, r.Agents)
+	}
+	title := fmt.Sprintf("%s | %d seconds | %s file size", vus, r.Config.Duration, sizeDistribution)
+	if r.SSE != "" {
+		title += " | " + r.SSE
+	}
+	return title
+}
+
+func newHTMLReport(report *performanceReport) (*htmlReport, error) {
+	sizeDistribution, err := util.ParseSizeDistribution(report.Config.FileSize)
+	if err != nil {
+		return nil, err
+	}
+	title := report.title()
+	retryPolicy := report.RetryPolicy
+	if retryPolicy == "" {
+		retryPolicy = "unknown retry policy"
+	}
+
+	page := &htmlReport{
+		Title:     title,
+		Generated: time.Now().Format(time.RFC1123),
+	}
+	agents := ""
+	if report.Agents > 0 {
+		agents = fmt.Sprint(report.Agents)
+	}
+	for _, field := range []htmlField{
+		{"Start", report.Start.Format(time.RFC1123)},
+		{"Elapsed", time.Duration(report.Elapsed * float64(time.Second)).Round(time.Millisecond).String()},
+		{"Endpoint", report.Endpoint},
+		{"Agents", agents},
+		{"Virtual users", fmt.Sprint(report.Config.VUs)},
+		{"Duration", fmt.Sprintf("%d seconds", report.Config.Duration)},
+		{"Warm-up", secondsField(report.Config.WarmUp)},
+		{"Cool-down", secondsField(report.Config.CoolDown)},
+		{"File size", sizeDistribution.String()},
+		{"Payload", report.Config.Payload},
+		{"Seed", fmt.Sprint(report.Config.Seed)},
+		{"Verify", fmt.Sprint(report.Config.Verify)},
+		{"Server-side encryption", report.SSE},
+		{"Retries", report.RetryPolicy},
+	} {
+		if field.Value != "" {
+			page.Fields = append(page.Fields, field)
+		}
+	}
+
+	page.Charts = append(page.Charts, timelineCharts(report.Timeline)...)
+	page.Charts = append(page.Charts, distributionCharts(report.Results)...)
+
+	tables := performanceTables(report.Results, title, sizeDistribution, retryPolicy)
+	if len(report.Phases) > 0 {
+		tables = append(tables, phaseTable(report.Results, report.Phases))
+	}
+	for _, resultTable := range tables {
+		htmlTable := htmlTable{Title: resultTable.title}
+		for _, column := range resultTable.header {
+			htmlTable.Header = append(htmlTable.Header, fmt.Sprint(column))
+		}
+		for _, row := range resultTable.rows {
+			if row == nil {
+				htmlTable.Rows = append(htmlTable.Rows, nil)
+				continue
+			}
+			cells := make([]string, 0, len(row))
+			for _, cell := range row {
+				cells = append(cells, fmt.Sprint(cell))
+			}
+			htmlTable.Rows = append(htmlTable.Rows, cells)
+		}
+		page.Tables = append(page.Tables, htmlTable)
+	}
+	return page, nil
+}
+
+// secondsField leaves out phases that were not configured.
+func secondsField(seconds int) string {
+	if seconds == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+// timelineCharts plots latency, throughput, speed and errors per second of the run.
+func timelineCharts(timeline []timelinePoint) []template.HTML {
+	if len(timeline) == 0 {
+		return nil
+	}
+
+	latency := make([]chartSeries, 0)
+	throughput := make([]chartSeries, 0)
+	speed := make([]chartSeries, 0)
+	failures := make([]chartSeries, 0)
+	hasFailures := false
+	for _, operation := range reportOperations {
+		p50 := chartSeries{name: operation.name + " P50", color: operationColors[operation.name]}
+		p99 := chartSeries{name: operation.name + " P99", color: operationColors[operation.name], dashed: true}
+		operations := chartSeries{name: operation.name, color: operationColors[operation.name]}
+		speeds := chartSeries{name: operation.name, color: operationColors[operation.name]}
+		failed := chartSeries{name: operation.name, color: operationColors[operation.name]}
+		ran := false
+		for i := range timeline {
+			point := operation.timeline(&timeline[i])
+			second := float64(timeline[i].Second)
+			ran = ran || point.Operations > 0
+			hasFailures = hasFailures || point.Operations > point.Successes
+			operations.points = append(operations.points, chartPoint{second, float64(point.Successes)})
+			failed.points = append(failed.points, chartPoint{second, float64(point.Operations - point.Successes)})
+			if point.Successes > 0 {
+				p50.points = append(p50.points, chartPoint{second, point.P50})
+				p99.points = append(p99.points, chartPoint{second, point.P99})
+				speeds.points = append(speeds.points, chartPoint{second, point.Speed / 1000000})
+			}
+		}
+		if !ran {
+			continue
+		}
+		latency = append(latency, p50, p99)
+		throughput = append(throughput, operations)
+		failures = append(failures, failed)
+		if operation.transfers {
+			speed = append(speed, speeds)
+		}
+	}
+
+	second := chartAxis{label: "Time [s]"}
+	charts := []template.HTML{
+		lineChart("Latency over time", second, chartAxis{label: "Latency [ms]"}, latency),
+		lineChart("Throughput over time", second, chartAxis{label: "Successful operations [1/s]"}, throughput),
+		lineChart("Mean speed over time", second, chartAxis{label: "Speed [MB/s]"}, speed),
+	}
+	if hasFailures {
+		charts = append(charts, lineChart("Errors over time", second, chartAxis{label: "Failed operations [1/s]"}, failures))
+	}
+	return charts
+}
+
+// distributionCharts plots the latency histogram and CDF of every operation.
+func distributionCharts(results *performanceResults) []template.HTML {
+	histogram := make([]chartSeries, 0)
+	cdf := make([]chartSeries, 0)
+	for _, operation := range reportOperations {
+		times := &operation.results(&results.operationSet).Times
+		if times.Count == 0 {
+			continue
+		}
+		bins := chartSeries{name: operation.name, color: operationColors[operation.name]}
+		for _, bin := range times.Bins(histogramChartBins) {
+			// plot the share per bin at the geometric middle of the bin
+			middle := bin.Upper
+			if bin.Lower > 0 {
+				middle = math.Sqrt(bin.Lower * bin.Upper)
+			}
+			bins.points = append(bins.points, chartPoint{middle, float64(bin.Count) / float64(times.Count) * 100})
+		}
+		histogram = append(histogram, bins)
+
+		percentiles := chartSeries{name: operation.name, color: operationColors[operation.name]}
+		for _, percentile := range cdfPercentiles {
+			percentiles.points = append(percentiles.points, chartPoint{times.Percentile(percentile), percentile})
+		}
+		cdf = append(cdf, percentiles)
+	}
+	if len(histogram) == 0 {
+		return nil
+	}
+
+	latency := chartAxis{label: "Latency [ms]", logarithmic: true}
+	return []template.HTML{
+		lineChart("Latency distribution", latency, chartAxis{label: "Operations [%]"}, histogram),
+		lineChart("Latency CDF", latency, chartAxis{label: "Percentile"}, cdf),
+	}
+}
+
+func writeHTMLReport(path string, report *performanceReport) error {
+	page, err := newHTMLReport(report)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = htmlReportTemplate.Execute(file, page)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeReports writes the report to the files given with --output and --html.
+func writeReports(c *cli.Context, report *performanceReport) {
+	if output := c.String("output"); output != "" {
+		err := writePerformanceReport(output, report)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Failed to write results to '%s'", output)
+		}
+		log.Info().Msgf("Results written to '%s'", output)
+	}
+	if html := c.String("html"); html != "" {
+		err := writeHTMLReport(html, report)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Failed to write HTML report to '%s'", html)
+		}
+		log.Info().Msgf("HTML report written to '%s'", html)
+	}
+}
+
+func htmlReportCommand(c *cli.Context) error {
+	if c.Args().Len() != 2 {
+		log.Fatal().Msg("Please specify a results file and the HTML file to write")
+	}
+	report, err := readPerformanceReport(c.Args().Get(0))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to read results")
+	}
+	err = writeHTMLReport(c.Args().Get(1), report)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to write HTML report")
+	}
+	log.Info().Msgf("HTML report written to '%s'", c.Args().Get(1))
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeline(t *testing.T) {
+	timeline := newTimeline(time.Now().Add(-1500 * time.Millisecond))
+	for _, elapsed := range []time.Duration{50, 80} {
+		interval := &performanceResults{}
+		interval.Upload.record(elapsed*time.Millisecond, 1000000, &attemptTracker{requests: map[string]int{}}, nil)
+		interval.Upload.record(elapsed*time.Millisecond, 1000000, &attemptTracker{requests: map[string]int{}}, errors.New("failed"))
+		timeline.add(interval)
+	}
+	timeline.start = timeline.start.Add(-time.Second)
+	timeline.add(&performanceResults{})
+
+	points := timeline.points()
+	if len(points) != 2 || points[0].Second != 2 || points[1].Second != 3 {
+		t.Fatalf("Expected the intervals in seconds 2 and 3 but got %+v", points)
+	}
+	upload := points[0].Upload
+	if upload.Operations != 4 || upload.Successes != 2 || math.Abs(upload.P50-50) > 0.5 || upload.P99 != 80 {
+		t.Errorf("Expected the intervals of one second to be merged but got %+v", upload)
+	}
+	if points[1].Upload.Operations != 0 {
+		t.Errorf("Expected an empty second but got %+v", points[1].Upload)
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	report := newSyntheticReport(1, 100, 5)
+	report.Results.Upload.recordErrors("SlowDown", 5)
+	report.RetryPolicy = "10 max attempts | 200ms backoff unit | 1s backoff cap"
+	for second := 1; second <= 10; second++ {
+		report.Timeline = append(report.Timeline, timelinePoint{
+			Second: second,
+			Upload: timelineOperation{Operations: 101, Successes: 100, P50: 100, P99: 200, Speed: 10000000},
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	err := writeHTMLReport(path, report)
+	if err != nil {
+		t.Fatalf("Failed to write HTML report: %s", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read HTML report: %s", err)
+	}
+	html := string(data)
+
+	for _, expected := range []string{
+		"Latency over time", "Throughput over time", "Mean speed over time", "Errors over time", "Latency distribution", "Latency CDF",
+		"S3 Performance Times | 1 VUs | 10 seconds", "S3 Retries | 10 max attempts", "S3 Errors", "SlowDown",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected the report to contain '%s'", expected)
+		}
+	}
+	if strings.Count(html, "<svg") != 6 {
+		t.Errorf("Expected 6 charts but got %d", strings.Count(html, "<svg"))
+	}
+	if strings.Contains(html, "<script") || strings.Contains(html, "src=") || strings.Contains(html, "<link") {
+		t.Errorf("Expected a self-contained report")
+	}
+	if strings.Contains(html, "Download P50") {
+		t.Errorf("Expected operations that did not run to be left out of the charts")
+	}
+}
+
+func TestHTMLReportPhases(t *testing.T) {
+	report := newSyntheticReport(1, 100, 0)
+	report.Config.WarmUp = 5
+	report.Phases = map[string]*performanceResults{phaseWarmUp: newSyntheticReport(2, 400, 0).Results}
+
+	page, err := newHTMLReport(report)
+	if err != nil {
+		t.Fatalf("Failed to create HTML report: %s", err)
+	}
+	fields := map[string]string{}
+	for _, field := range page.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Warm-up"] != "5 seconds" {
+		t.Errorf("Expected the warm-up to be listed but got '%s'", fields["Warm-up"])
+	}
+	if _, ok := fields["Cool-down"]; ok {
+		t.Errorf("Expected the cool-down to be left out")
+	}
+
+	last := page.Tables[len(page.Tables)-1]
+	if !strings.HasPrefix(last.Title, "S3 Phases") {
+		t.Fatalf("Expected the phase table last but got '%s'", last.Title)
+	}
+	if len(last.Rows) != 7 || last.Rows[0][0] != phaseWarmUp || last.Rows[4][0] != "measured" {
+		t.Errorf("Expected the warm-up and measured phases but got %v", last.Rows)
+	}
+}
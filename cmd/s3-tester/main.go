@@ -1,20 +1,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/mxcd/tester-toolbox/internal/util"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -75,6 +73,34 @@ func main() {
 				Usage:   "s3 insecure connection",
 				EnvVars: []string{"S3_INSECURE"},
 			},
+			&cli.IntFlag{
+				Name:    "max-attempts",
+				Usage:   "maximum attempts per s3 request including retries",
+				Value:   10,
+				EnvVars: []string{"S3_MAX_ATTEMPTS"},
+			},
+			&cli.DurationFlag{
+				Name:    "retry-unit",
+				Usage:   "base backoff between s3 request retries",
+				Value:   200 * time.Millisecond,
+				EnvVars: []string{"S3_RETRY_UNIT"},
+			},
+			&cli.DurationFlag{
+				Name:    "retry-cap",
+				Usage:   "maximum backoff between s3 request retries",
+				Value:   time.Second,
+				EnvVars: []string{"S3_RETRY_CAP"},
+			},
+			&cli.DurationFlag{
+				Name:    "request-timeout",
+				Usage:   "timeout of a single s3 request including its response body, 0 disables it",
+				EnvVars: []string{"S3_REQUEST_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "sse",
+				Usage:   "server-side encryption: s3, kms:<key-id> or c:<base64 key>",
+				EnvVars: []string{"S3_SSE"},
+			},
 		},
 		Commands: []*cli.Command{
 			{
@@ -86,6 +112,15 @@ func main() {
 					return upload(c)
 				},
 			},
+			{
+				Name:    "download",
+				Aliases: []string{"d"},
+				Usage:   "Download an object from the specified S3 bucket",
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return download(c)
+				},
+			},
 			{
 				Name:    "remove",
 				Aliases: []string{"r"},
@@ -96,8 +131,15 @@ func main() {
 				},
 			},
 			{
-				Name:    "url",
-				Usage:   "Generates a pre-signed URL for the specified S3 object",
+				Name:  "url",
+				Usage: "Generates a pre-signed URL for the specified S3 object",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "expiry",
+						Usage: "Validity of the URL, at most 7 days",
+						Value: time.Minute,
+					},
+				},
 				Action: func(c *cli.Context) error {
 					initLogger(c)
 					return sign(c)
@@ -106,23 +148,215 @@ func main() {
 			{
 				Name:  "performance",
 				Usage: "Tests S3 performance. s3-tester performance",
+				Flags: append(performanceFlags(), append(tracingFlags(), metricsFlags()...)...),
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return performance(c)
+				},
+			},
+			{
+				Name:  "soak",
+				Usage: "Runs a performance workload for hours or days with rolling summaries and drift detection",
+				Flags: append(soakFlags(), append(tracingFlags(), metricsFlags()...)...),
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return soak(c)
+				},
+			},
+			{
+				Name:  "agent",
+				Usage: "Runs performance workloads on behalf of a coordinator",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "Address the agent listens on for the coordinator",
+						Value: ":7070",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return agent(c)
+				},
+			},
+			{
+				Name:  "coordinator",
+				Usage: "Runs a performance test distributed across agents and merges their results",
+				Flags: append(performanceFlags(),
+					&cli.StringSliceFlag{
+						Name:  "agents",
+						Usage: "Agent addresses, e.g. 10.0.0.1:7070,10.0.0.2:7070",
+					},
+					&cli.DurationFlag{
+						Name:  "start-delay",
+						Usage: "Delay before all agents start the workload in sync",
+						Value: 2 * time.Second,
+					},
+				),
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return coordinator(c)
+				},
+			},
+			{
+				Name:  "sse-check",
+				Usage: "Checks that SSE-C encrypted objects cannot be read without their key",
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return sseCheck(c)
+				},
+			},
+			{
+				Name:  "versioning",
+				Usage: "Tests overwrites, version reads and delete markers on the versioned bucket",
 				Flags: []cli.Flag{
 					&cli.IntFlag{
-						Name:  "vus",
-						Usage: "Virtual users",
+						Name:  "keys",
+						Usage: "Number of keys to overwrite",
+						Value: 5,
 					},
 					&cli.IntFlag{
-						Name:  "duration",
-						Usage: "Duration in seconds",
+						Name:  "overwrites",
+						Usage: "Number of versions written per key",
+						Value: 10,
 					},
 					&cli.StringFlag{
 						Name:  "filesize",
-						Usage: "File size in bytes",
+						Usage: "File size of every version",
+						Value: "64KiB",
+					},
+					&cli.StringFlag{
+						Name:  "baseline-bucket",
+						Usage: "Unversioned bucket to compare the overhead of versioning against",
 					},
 				},
 				Action: func(c *cli.Context) error {
 					initLogger(c)
-					return performance(c)
+					return versioning(c)
+				},
+			},
+			{
+				Name:  "object-lock",
+				Usage: "Checks that retention and legal holds block deletion on the object lock bucket",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "mode",
+						Usage: "Retention mode: GOVERNANCE or COMPLIANCE. COMPLIANCE objects remain until their retention expires",
+						Value: "GOVERNANCE",
+					},
+					&cli.DurationFlag{
+						Name:  "retention",
+						Usage: "Retention period of the test object",
+						Value: time.Minute,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return objectLock(c)
+				},
+			},
+			{
+				Name:  "mock-server",
+				Usage: "Serves an in-memory S3 mock with the configured credentials for tests and demos",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "Address the mock server listens on",
+						Value: ":9000",
+					},
+					&cli.DurationFlag{
+						Name:  "latency",
+						Usage: "Latency added to every request",
+					},
+					&cli.DurationFlag{
+						Name:  "jitter",
+						Usage: "Maximum random latency added on top of --latency",
+					},
+					&cli.Float64Flag{
+						Name:  "slowdown-rate",
+						Usage: "Fraction of requests answered with 503 SlowDown, e.g. 0.05",
+					},
+					&cli.Float64Flag{
+						Name:  "error-rate",
+						Usage: "Fraction of requests answered with 500 InternalError, e.g. 0.01",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return mockServer(c)
+				},
+			},
+			{
+				Name:  "chaos-proxy",
+				Usage: "Proxies the configured S3 endpoint and injects latency, bandwidth caps, slowdowns, resets and truncated bodies",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "Address the proxy listens on",
+						Value: ":9001",
+					},
+					&cli.DurationFlag{
+						Name:  "latency",
+						Usage: "Latency added to every request",
+					},
+					&cli.DurationFlag{
+						Name:  "jitter",
+						Usage: "Maximum random latency added on top of --latency",
+					},
+					&cli.StringFlag{
+						Name:  "bandwidth",
+						Usage: "Bandwidth cap per request and direction, e.g. 10MiB for 10MiB/s",
+					},
+					&cli.Float64Flag{
+						Name:  "slowdown-rate",
+						Usage: "Fraction of requests answered with 503 SlowDown",
+					},
+					&cli.Float64Flag{
+						Name:  "reset-rate",
+						Usage: "Fraction of requests whose connection is reset",
+					},
+					&cli.Float64Flag{
+						Name:  "truncate-rate",
+						Usage: "Fraction of responses cut off before the announced length",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return chaosProxy(c)
+				},
+			},
+			{
+				Name:      "compare",
+				Usage:     "Compares two performance results written with --output and fails on regressions",
+				ArgsUsage: "baseline.json current.json",
+				Flags: []cli.Flag{
+					&cli.Float64Flag{
+						Name:  "tolerance",
+						Usage: "Relative change in percent a metric may get worse by",
+						Value: 10,
+					},
+					&cli.Float64Flag{
+						Name:  "error-tolerance",
+						Usage: "Increase of the error rate in percentage points that is tolerated",
+						Value: 1,
+					},
+					&cli.Float64Flag{
+						Name:  "alpha",
+						Usage: "Significance level of the Mann-Whitney U test on latencies and speeds",
+						Value: 0.05,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return compare(c)
+				},
+			},
+			{
+				Name:      "report",
+				Usage:     "Renders a performance result written with --output as a self-contained HTML report",
+				ArgsUsage: "results.json report.html",
+				Action: func(c *cli.Context) error {
+					initLogger(c)
+					return htmlReportCommand(c)
 				},
 			},
 		},
@@ -162,10 +396,11 @@ func upload(c *cli.Context) error {
 	S3_BUCKET := c.String("bucket")
 
 	progress := progressbar.DefaultBytes(fileSize)
-	reader := io.MultiReader(file, progress)
+
+	sse := getServerSideEncryption(c)
 
 	startTime := time.Now()
-	_, err = client.PutObject(context.Background(), S3_BUCKET, id, reader, fileSize, minio.PutObjectOptions{ContentType: "application/octet-stream", Progress: progress})
+	_, err = client.PutObject(context.Background(), S3_BUCKET, id, file, fileSize, minio.PutObjectOptions{ContentType: "application/octet-stream", Progress: progress, ServerSideEncryption: sse})
 	elapsedTime := time.Since(startTime)
 	if err != nil {
 		log.Err(err).Msg("Failed to upload")
@@ -177,6 +412,51 @@ func upload(c *cli.Context) error {
 	return nil
 }
 
+func download(c *cli.Context) error {
+	if c.Args().Len() < 1 || c.Args().Len() > 2 {
+		log.Fatal().Msg("Please specify an object to download and optionally a target file")
+	}
+	id := c.Args().First()
+	client := getS3Client(c)
+	S3_BUCKET := c.String("bucket")
+	sse := getServerSideEncryption(c)
+
+	stat, err := client.StatObject(context.Background(), S3_BUCKET, id, minio.StatObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to stat object '%s'", id)
+	}
+	log.Info().Msgf("Object '%s' exists with size '%s'", id, util.GetStringFromByteSize(stat.Size))
+
+	var target io.Writer = io.Discard
+	if c.Args().Len() == 2 {
+		file, err := os.Create(c.Args().Get(1))
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Failed to create file '%s'", c.Args().Get(1))
+		}
+		defer file.Close()
+		target = file
+	}
+
+	progress := progressbar.DefaultBytes(stat.Size)
+
+	startTime := time.Now()
+	object, err := client.GetObject(context.Background(), S3_BUCKET, id, minio.GetObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to download object '%s'", id)
+	}
+	defer object.Close()
+	fileSize, err := io.Copy(io.MultiWriter(target, progress), object)
+	elapsedTime := time.Since(startTime)
+	if err != nil {
+		log.Err(err).Msg("Failed to download")
+	}
+
+	log.Info().Msgf("Downloaded object with '%s' in %s", util.GetStringFromByteSize(fileSize), elapsedTime)
+	downloadSpeed := float64(fileSize) / elapsedTime.Seconds()
+	log.Info().Msgf("Average download speed: %s/s", util.GetStringFromByteSize(int64(downloadSpeed)))
+	return nil
+}
+
 func remove(c *cli.Context) error {
 	if c.Args().Len() != 1 {
 		log.Fatal().Msg("Please specify an object to remove")
@@ -198,6 +478,10 @@ func sign(c *cli.Context) error {
 		log.Fatal().Msg("Please specify an object sign the URL for")
 	}
 	id := c.Args().First()
+	expiry := c.Duration("expiry")
+	if expiry < time.Second || expiry > 7*24*time.Hour {
+		log.Fatal().Msgf("The expiry must be between 1s and 7 days, got %s", expiry)
+	}
 	client := getS3Client(c)
 	S3_BUCKET := c.String("bucket")
 
@@ -207,7 +491,7 @@ func sign(c *cli.Context) error {
 	requestParams.Set("response-content-disposition", "attachment;")
 
 	// Gernerate presigned get object url.
-	presignedURL, err := client.PresignedGetObject(context.Background(), S3_BUCKET, id, time.Duration(1)*time.Minute, requestParams)
+	presignedURL, err := client.PresignedGetObject(context.Background(), S3_BUCKET, id, expiry, requestParams)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to generate presigned URL for object '%s'", id)
 		return err
@@ -278,244 +562,48 @@ func getS3Client(c *cli.Context) *minio.Client {
 		log.Fatal().Msg("Please specify an S3 secret key")
 	}
 
+	applyRetryPolicy(c)
+
 	log.Info().Msgf("Connecting to S3 host '%s' on port '%d'", S3_ENDPOINT, S3_PORT)
 
 	endpoint := fmt.Sprintf("%s:%d", S3_ENDPOINT, S3_PORT)
 
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(S3_ACCESS_KEY, S3_SECRET_KEY, ""),
-		Secure: S3_SSL,
-	})
+	transport, err := minio.DefaultTransport(S3_SSL)
 	if err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("Failed to create S3 transport")
 	}
-
-	return client
-}
-
-func performance(c *cli.Context) error {
-	vus := c.Int("vus")
-	if vus == 0 {
-		vus = 1
+	var baseTransport http.RoundTripper = transport
+	requestTimeout := c.Duration("request-timeout")
+	if requestTimeout < 0 {
+		log.Fatal().Msgf("The request timeout must not be negative, got %s", requestTimeout)
 	}
-
-	duration := c.Int("duration")
-	if duration == 0 {
-		duration = 30
+	if requestTimeout > 0 {
+		baseTransport = &timeoutTransport{base: transport, timeout: requestTimeout}
 	}
 
-	stringFileSize := c.String("filesize")
-	if stringFileSize == "" {
-		stringFileSize = "500KiB"
-	}
-	byteFileSize, err := util.GetByteSizeFromString(stringFileSize)
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(S3_ACCESS_KEY, S3_SECRET_KEY, ""),
+		Secure:    S3_SSL,
+		Transport: &attemptTransport{base: &tracingTransport{base: baseTransport}},
+	})
 	if err != nil {
-		log.Fatal().Err(err).Msgf("Failed to parse file size: '%s'", stringFileSize)
-		return err
-	}
-
-	log.Info().Msgf("Starting performance test with %d virtual users for %d seconds and a random file of %s ", vus, duration, util.GetStringFromByteSize(byteFileSize))
-
-	client := getS3Client(c)
-	S3_BUCKET := c.String("bucket")
-	mutex := sync.Mutex{}
-	uploadTimes := make([]float64, 0)
-	uploadSpeeds := make([]float64, 0)
-	downloadTimes := make([]float64, 0)
-	downloadSpeeds := make([]float64, 0)
-	deleteTimes := make([]float64, 0)
-	iterationDelta := 0
-	errorCount := 0
-
-	stop := false
-
-	performanceTest := func() {
-		id := uuid.New().String()
-
-		randomFile := make([]byte, byteFileSize)
-		rand.Read(randomFile)
-
-		startTime := time.Now()
-		_, err := client.PutObject(context.Background(), S3_BUCKET, id, bytes.NewReader(randomFile), byteFileSize, minio.PutObjectOptions{ContentType: "application/octet-stream"})
-
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to upload")
-			mutex.Lock()
-			errorCount++
-			mutex.Unlock()
-			return
-		} else {
-			elapsedTime := time.Since(startTime)
-			mutex.Lock()
-			iterationDelta++
-			uploadTimes = append(uploadTimes, float64(elapsedTime.Milliseconds()))
-			uploadSpeeds = append(uploadSpeeds, float64(byteFileSize)/elapsedTime.Seconds())
-			mutex.Unlock()
-		}
-
-		startTime = time.Now()
-		s3Object, err := client.GetObject(context.Background(), S3_BUCKET, id, minio.GetObjectOptions{})
-		if err != nil {
-			log.Error().Err(err).Msgf("Failed to init object download '%s'", id)
-			mutex.Lock()
-			errorCount++
-			mutex.Unlock()
-			return
-		}
-
-		data, err := io.ReadAll(s3Object)
-		log.Trace().Msgf("Downloaded %d bytes", len(data))
-
-		if err != nil {
-			log.Error().Err(err).Msgf("Failed to download object '%s'", id)
-			mutex.Lock()
-			errorCount++
-			mutex.Unlock()
-			return
-		} else {
-			elapsedTime := time.Since(startTime)
-			mutex.Lock()
-			downloadTimes = append(downloadTimes, float64(elapsedTime.Milliseconds()))
-			downloadSpeeds = append(downloadSpeeds, float64(byteFileSize)/elapsedTime.Seconds())
-			mutex.Unlock()
-		}
-
-		startTime = time.Now()
-		err = client.RemoveObject(context.Background(), S3_BUCKET, id, minio.RemoveObjectOptions{})
-		if err != nil {
-			log.Error().Err(err).Msgf("Failed to remove object '%s'", id)
-			mutex.Lock()
-			errorCount++
-			mutex.Unlock()
-			return
-		} else {
-			elapsedTime := time.Since(startTime)
-			mutex.Lock()
-			deleteTimes = append(deleteTimes, float64(elapsedTime.Milliseconds()))
-			mutex.Unlock()
-		}
-
-		mutex.Lock()
-		iterationDelta++
-		mutex.Unlock()
-	}
-
-	wg := sync.WaitGroup{}
-
-	worker := func(id int) {
-		defer wg.Done()
-		wg.Add(1)
-		for {
-			log.Trace().Msgf("Starting upload for worker %d", id)
-			performanceTest()
-			log.Trace().Msgf("Finished upload for worker %d", id)
-			mutex.Lock()
-			if stop {
-				break
-			}
-			mutex.Unlock()
-		}
-		mutex.Unlock()
+		log.Fatal().Err(err)
 	}
 
-	for i := 0; i < vus; i++ {
-		go worker(i)
-	}
+	return client
+}
 
-	progress := progressbar.Default(-1)
+// s3Target bundles everything S3 operations of the workloads need.
+type s3Target struct {
+	client *minio.Client
+	bucket string
+	sse    encrypt.ServerSide
+}
 
-	for i := 0; i < duration; i++ {
-		mutex.Lock()
-		progress.Add(iterationDelta)
-		iterationDelta = 0
-		if errorCount > 100 {
-			log.Error().Msg("Too many errors. Stopping performance test")
-			break
-		}
-		mutex.Unlock()
-		time.Sleep(1 * time.Second)
+func getS3Target(c *cli.Context) *s3Target {
+	return &s3Target{
+		client: getS3Client(c),
+		bucket: c.String("bucket"),
+		sse:    getServerSideEncryption(c),
 	}
-
-	progress.Finish()
-	log.Info().Msg("Finalizing current worker jobs")
-	mutex.Lock()
-	stop = true
-	mutex.Unlock()
-
-	wg.Wait()
-
-	log.Info().Msg("Performance test finished")
-
-	t := table.NewWriter()
-	t.SetTitle(fmt.Sprintf("S3 Performance Times | %d VUs | %d seconds | %s file size", vus, duration, util.GetStringFromByteSize(byteFileSize)))
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Operation", "T min [ms]", "T max [ms]", "P50 [ms]", "P90 [ms]", "P99 [ms]", "Mean [ms]", "Std Dev [ms]"})
-
-	t.AppendRow(table.Row{
-		"Upload Time",
-		fmt.Sprintf("%.1f", util.GetMinFloat64(uploadTimes)),
-		fmt.Sprintf("%.1f", util.GetMaxFloat64(uploadTimes)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(uploadTimes, 50)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(uploadTimes, 90)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(uploadTimes, 99)),
-		fmt.Sprintf("%.1f", util.GetMean(uploadTimes)),
-		fmt.Sprintf("%.1f", util.GetStdDevFloat64(uploadTimes)),
-	})
-
-	t.AppendRow(table.Row{
-		"Download",
-		fmt.Sprintf("%.1f", util.GetMinFloat64(downloadTimes)),
-		fmt.Sprintf("%.1f", util.GetMaxFloat64(downloadTimes)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(downloadTimes, 50)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(downloadTimes, 90)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(downloadTimes, 99)),
-		fmt.Sprintf("%.1f", util.GetMean(downloadTimes)),
-		fmt.Sprintf("%.1f", util.GetStdDevFloat64(downloadTimes)),
-	})
-
-	t.AppendRow(table.Row{
-		"Delete",
-		fmt.Sprintf("%.1f", util.GetMinFloat64(deleteTimes)),
-		fmt.Sprintf("%.1f", util.GetMaxFloat64(deleteTimes)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(deleteTimes, 50)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(deleteTimes, 90)),
-		fmt.Sprintf("%.1f", util.GetPercentileFloat64(deleteTimes, 99)),
-		fmt.Sprintf("%.1f", util.GetMean(deleteTimes)),
-		fmt.Sprintf("%.1f", util.GetStdDevFloat64(deleteTimes)),
-	})
-
-	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
-	t.Render()
-
-	t = table.NewWriter()
-	t.SetTitle(fmt.Sprintf("S3 Performance Speeds | %d VUs | %d seconds | %s file size", vus, duration, util.GetStringFromByteSize(byteFileSize)))
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"Operation", "min [MB/s]", "max [MB/s]", "P50 [MB/s]", "P10 [MB/s]", "P1 [MB/s]", "Mean [MB/s]", "Std Dev [MB/s]"})
-
-	t.AppendRow(table.Row{
-		"Upload Speed",
-		fmt.Sprintf("%.2f", util.GetMinFloat64(uploadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetMaxFloat64(uploadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(uploadSpeeds, 50)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(uploadSpeeds, 10)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(uploadSpeeds, 1)/1000000),
-		fmt.Sprintf("%.2f", util.GetMean(uploadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetStdDevFloat64(uploadSpeeds)/1000000),
-	})
-
-	t.AppendRow(table.Row{
-		"Download Speed",
-		fmt.Sprintf("%.2f", util.GetMinFloat64(downloadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetMaxFloat64(downloadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(downloadSpeeds, 50)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(downloadSpeeds, 10)/1000000),
-		fmt.Sprintf("%.2f", util.GetPercentileFloat64(downloadSpeeds, 1)/1000000),
-		fmt.Sprintf("%.2f", util.GetMean(downloadSpeeds)/1000000),
-		fmt.Sprintf("%.2f", util.GetStdDevFloat64(downloadSpeeds)/1000000),
-	})
-
-	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
-	t.Render()
-
-	return nil
 }
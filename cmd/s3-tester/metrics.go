@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const metricsNamespace = "s3_tester"
+
+// performanceMetrics exports the operations of a running performance test
+// as Prometheus metrics.
+type performanceMetrics struct {
+	registry     *prometheus.Registry
+	operations   *prometheus.CounterVec
+	durations    *prometheus.HistogramVec
+	bytes        *prometheus.CounterVec
+	retries      *prometheus.CounterVec
+	throttled    *prometheus.CounterVec
+	virtualUsers prometheus.Gauge
+}
+
+func newPerformanceMetrics() *performanceMetrics {
+	m := &performanceMetrics{
+		registry: prometheus.NewRegistry(),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "operations_total",
+			Help:      "Finished S3 operations by operation and status.",
+		}, []string{"operation", "status"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of S3 operations including retries by operation and status.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"operation", "status"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "transferred_bytes_total",
+			Help:      "Bytes of successfully uploaded and downloaded objects.",
+		}, []string{"operation"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "retries_total",
+			Help:      "Retried S3 requests by operation.",
+		}, []string{"operation"}),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "throttled_responses_total",
+			Help:      "503 and 429 responses by operation.",
+		}, []string{"operation"}),
+		virtualUsers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "virtual_users",
+			Help:      "Virtual users of the running performance test.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.operations, m.durations, m.bytes, m.retries, m.throttled, m.virtualUsers,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// metricsStatus keeps the status label bounded: S3 error codes are kept,
+// transport and verification errors are all counted as "error".
+func metricsStatus(err error) string {
+	if err == nil {
+		return "success"
+	}
+	if response := minio.ToErrorResponse(err); response.Code != "" {
+		return response.Code
+	}
+	return "error"
+}
+
+func (m *performanceMetrics) observe(operation string, elapsedTime time.Duration, size int64, tracker *attemptTracker, err error) {
+	status := metricsStatus(err)
+	m.operations.WithLabelValues(operation, status).Inc()
+	m.durations.WithLabelValues(operation, status).Observe(elapsedTime.Seconds())
+	m.retries.WithLabelValues(operation).Add(float64(tracker.attempts() - 1))
+	m.throttled.WithLabelValues(operation).Add(float64(tracker.throttledResponses()))
+	if err == nil && size > 0 {
+		m.bytes.WithLabelValues(operation).Add(float64(size))
+	}
+}
+
+func (m *performanceMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// serve exposes the metrics on /metrics of listen in the background.
+func (m *performanceMetrics) serve(listen string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.handler())
+	go func() {
+		err := http.Serve(listener, mux)
+		if err != nil {
+			log.Error().Err(err).Msg("Metrics server stopped")
+		}
+	}()
+	return nil
+}
+
+func metricsFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "metrics-listen",
+			Usage: "Serve live Prometheus metrics of the run on the given address, e.g. :9100",
+		},
+	}
+}
+
+// serveMetrics serves the metrics of a run with vus virtual users if
+// --metrics-listen is given and returns the observers to pass to
+// runPerformance.
+func serveMetrics(c *cli.Context, vus int) []operationObserver {
+	listen := c.String("metrics-listen")
+	if listen == "" {
+		return nil
+	}
+	metrics := newPerformanceMetrics()
+	metrics.virtualUsers.Set(float64(vus))
+	err := metrics.serve(listen)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to serve metrics on '%s'", listen)
+	}
+	log.Info().Msgf("Serving Prometheus metrics on %s/metrics", listen)
+	return []operationObserver{metrics}
+}
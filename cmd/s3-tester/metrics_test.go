@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+)
+
+func TestPerformanceMetrics(t *testing.T) {
+	useFastRetries(t)
+	minio.MaxRetry = 2
+	target := newMockTarget(t, s3mock_server.Options{SlowDownRate: 0.2, Seed: 1})
+	metrics := newPerformanceMetrics()
+	metrics.virtualUsers.Set(2)
+	config := performanceConfig{VUs: 2, Duration: 1, FileSize: "16KiB", Payload: "random"}
+	results := runMockPerformance(t, target, config, metrics)
+
+	server := httptest.NewServer(metrics.handler())
+	t.Cleanup(server.Close)
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %s", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	scrape := string(body)
+
+	failed := results.Upload.Operations - results.Upload.Successes
+	if failed == 0 || results.Upload.Throttled == 0 {
+		t.Fatalf("Expected throttled and failed uploads but got %d throttled and %d failed", results.Upload.Throttled, failed)
+	}
+	for _, expected := range []string{
+		fmt.Sprintf(`s3_tester_operations_total{operation="upload",status="success"} %d`, results.Upload.Successes),
+		fmt.Sprintf(`s3_tester_operations_total{operation="upload",status="SlowDown"} %d`, failed),
+		fmt.Sprintf(`s3_tester_operation_duration_seconds_count{operation="download",status="success"} %d`, results.Download.Successes),
+		`s3_tester_transferred_bytes_total{operation="upload"} ` + strconv.FormatFloat(float64(results.Upload.Successes*16*1024), 'g', -1, 64),
+		fmt.Sprintf(`s3_tester_throttled_responses_total{operation="upload"} %d`, results.Upload.Throttled),
+		`s3_tester_virtual_users 2`,
+		`# TYPE go_goroutines gauge`,
+	} {
+		if !strings.Contains(scrape, expected+"\n") {
+			t.Errorf("Expected metric '%s' in the scrape", expected)
+		}
+	}
+}
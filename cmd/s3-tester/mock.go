@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func getMockOptions(c *cli.Context) s3mock_server.Options {
+	options := s3mock_server.Options{
+		AccessKey:    c.String("access-key"),
+		SecretKey:    c.String("secret-key"),
+		Latency:      c.Duration("latency"),
+		Jitter:       c.Duration("jitter"),
+		SlowDownRate: c.Float64("slowdown-rate"),
+		ErrorRate:    c.Float64("error-rate"),
+	}
+
+	if options.AccessKey == "" {
+		log.Fatal().Msg("Please specify an S3 access key")
+	}
+	if options.SecretKey == "" {
+		log.Fatal().Msg("Please specify an S3 secret key")
+	}
+	if options.Latency < 0 || options.Jitter < 0 {
+		log.Fatal().Msg("Latency and jitter must not be negative")
+	}
+	if options.SlowDownRate < 0 || options.ErrorRate < 0 || options.SlowDownRate+options.ErrorRate > 1 {
+		log.Fatal().Msg("Slowdown and error rates must be between 0 and 1 and add up to at most 1")
+	}
+	return options
+}
+
+func mockServer(c *cli.Context) error {
+	options := getMockOptions(c)
+	buckets := []string{}
+	if bucket := c.String("bucket"); bucket != "" {
+		buckets = append(buckets, bucket)
+		log.Info().Msgf("Creating bucket '%s'", bucket)
+	}
+	log.Info().Msgf("Injecting %s latency with %s jitter, %.1f%% slowdowns and %.1f%% errors", options.Latency, options.Jitter, options.SlowDownRate*100, options.ErrorRate*100)
+	return s3mock_server.StartServer(c.String("listen"), options, buckets...)
+}
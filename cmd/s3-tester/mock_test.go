@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+)
+
+const (
+	mockAccessKey = "mock-access-key"
+	mockSecretKey = "mock-secret-key"
+	mockBucket    = "mock-bucket"
+)
+
+// newMockServer starts an S3 mock on loopback with the mock bucket.
+func newMockServer(t *testing.T, options s3mock_server.Options) *httptest.Server {
+	options.AccessKey = mockAccessKey
+	options.SecretKey = mockSecretKey
+	server := s3mock_server.NewServer(options)
+	err := server.CreateBucket(mockBucket)
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %s", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// newTestTarget returns a target for the mock bucket at serverURL whose
+// client tracks attempts like the one created by getS3Client.
+func newTestTarget(t *testing.T, serverURL string) *s3Target {
+	return newTimeoutTestTarget(t, serverURL, 0)
+}
+
+// newTimeoutTestTarget is newTestTarget with a request timeout unless it is zero.
+func newTimeoutTestTarget(t *testing.T, serverURL string, timeout time.Duration) *s3Target {
+	transport, err := minio.DefaultTransport(false)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	var baseTransport http.RoundTripper = transport
+	if timeout > 0 {
+		baseTransport = &timeoutTransport{base: transport, timeout: timeout}
+	}
+	endpoint, _ := url.Parse(serverURL)
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:     credentials.NewStaticV4(mockAccessKey, mockSecretKey, ""),
+		Transport: &attemptTransport{base: &tracingTransport{base: baseTransport}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+	return &s3Target{client: client, bucket: mockBucket}
+}
+
+func newMockTarget(t *testing.T, options s3mock_server.Options) *s3Target {
+	return newTestTarget(t, newMockServer(t, options).URL)
+}
+
+// useFastRetries shortens the minio backoff for the duration of a test.
+func useFastRetries(t *testing.T) {
+	maxRetry, retryUnit, retryCap := minio.MaxRetry, minio.DefaultRetryUnit, minio.DefaultRetryCap
+	minio.MaxRetry, minio.DefaultRetryUnit, minio.DefaultRetryCap = 10, time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() {
+		minio.MaxRetry, minio.DefaultRetryUnit, minio.DefaultRetryCap = maxRetry, retryUnit, retryCap
+	})
+}
+
+func runMockPerformance(t *testing.T, target *s3Target, config performanceConfig, observers ...operationObserver) *performanceResults {
+	err := config.validate()
+	if err != nil {
+		t.Fatalf("Invalid configuration: %s", err)
+	}
+	results := &performanceResults{}
+	runPerformance(context.Background(), target, config, func(interval *performanceResults) {
+		results.merge(interval)
+	}, observers...)
+	return results
+}
+
+func TestPerformanceAgainstMock(t *testing.T) {
+	target := newMockTarget(t, s3mock_server.Options{})
+	config := performanceConfig{VUs: 2, Duration: 1, FileSize: "1KiB:50,96KiB:50", Payload: "compressible", Verify: true}
+	results := runMockPerformance(t, target, config)
+
+	if results.Upload.Successes == 0 {
+		t.Fatalf("Expected successful uploads")
+	}
+	for name, operation := range map[string]*operationResults{"upload": &results.Upload, "download": &results.Download, "delete": &results.Delete} {
+		if operation.Successes != operation.Operations {
+			t.Errorf("Expected all %d %s operations to succeed but %d did", operation.Operations, name, operation.Successes)
+		}
+		if operation.FirstAttemptSuccesses != operation.Successes || operation.Throttled != 0 {
+			t.Errorf("Expected no retries for %s but got %d throttled", name, operation.Throttled)
+		}
+	}
+	if len(results.SizeClasses) != 2 {
+		t.Errorf("Expected 2 size classes but got %d", len(results.SizeClasses))
+	}
+}
+
+func TestPerformanceRetriesAgainstMock(t *testing.T) {
+	useFastRetries(t)
+	target := newMockTarget(t, s3mock_server.Options{SlowDownRate: 0.3, Seed: 1})
+	config := performanceConfig{VUs: 2, Duration: 1, FileSize: "1KiB", Payload: "random"}
+	results := runMockPerformance(t, target, config)
+
+	if results.Upload.Throttled == 0 {
+		t.Errorf("Expected throttled uploads with a 30%% slowdown rate")
+	}
+	if results.Upload.Attempts.Max < 2 {
+		t.Errorf("Expected uploads with more than one attempt but got at most %.0f", results.Upload.Attempts.Max)
+	}
+	if results.Upload.Successes != results.Upload.Operations {
+		t.Errorf("Expected retries to recover all %d uploads but %d succeeded", results.Upload.Operations, results.Upload.Successes)
+	}
+	if results.Upload.FirstAttemptSuccesses >= results.Upload.Successes {
+		t.Errorf("Expected fewer first attempt successes than successes")
+	}
+}
+
+func TestPerformanceRequestTimeoutAgainstMock(t *testing.T) {
+	useFastRetries(t)
+	mock := s3mock_server.NewServer(s3mock_server.Options{AccessKey: mockAccessKey, SecretKey: mockSecretKey})
+	err := mock.CreateBucket(mockBucket)
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %s", err)
+	}
+	// only object requests are slow, minio does not retry the lookup of
+	// the bucket location
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/"+mockBucket+"/") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	target := newTimeoutTestTarget(t, server.URL, 20*time.Millisecond)
+	config := performanceConfig{VUs: 1, Duration: 1, FileSize: "1KiB", Payload: "random", MaxErrors: -1}
+	results := runMockPerformance(t, target, config)
+
+	if results.Upload.Operations == 0 || results.Upload.Successes != 0 {
+		t.Fatalf("Expected all uploads to time out but %d of %d succeeded", results.Upload.Successes, results.Upload.Operations)
+	}
+	if results.Upload.Attempts.Max <= 1 {
+		t.Errorf("Expected timed out uploads to be retried but got at most %.0f attempts", results.Upload.Attempts.Max)
+	}
+	// every attempt waits for the timeout instead of the 200ms latency, ten
+	// attempts waiting for the latency would take 2s per upload
+	if results.Upload.Operations < 3 {
+		t.Errorf("Expected the attempts to give up after the timeout but only %d uploads finished", results.Upload.Operations)
+	}
+	if results.Upload.Errors["request timed out after 20ms"] != results.Upload.Operations {
+		t.Errorf("Expected the uploads to fail with a request timeout but got %v", results.Upload.Errors)
+	}
+}
+
+func TestPerformancePhasesAgainstMock(t *testing.T) {
+	target := newMockTarget(t, s3mock_server.Options{})
+	config := performanceConfig{VUs: 1, Duration: 3, WarmUp: 1, CoolDown: 1, FileSize: "1KiB", Payload: "random"}
+	if err := config.validate(); err != nil {
+		t.Fatalf("Invalid configuration: %s", err)
+	}
+
+	phases := []string{}
+	start := time.Now()
+	run := newMeasurement(start, config)
+	runPerformance(context.Background(), target, config, func(interval *performanceResults) {
+		phases = append(phases, interval.Phase)
+		run.add(interval, time.Now())
+	})
+
+	expected := []string{phaseWarmUp, phaseMeasured, phaseMeasured, phaseMeasured, phaseCoolDown, phaseCoolDown}
+	if len(phases) != len(expected) {
+		t.Fatalf("Expected the phases %q but got %q", expected, phases)
+	}
+	for i := range expected {
+		if phases[i] != expected[i] {
+			t.Errorf("Expected interval %d to belong to phase '%s' but got '%s'", i, expected[i], phases[i])
+		}
+	}
+	for _, phase := range []string{phaseWarmUp, phaseCoolDown} {
+		if results, ok := run.phases[phase]; !ok || results.Upload.Operations == 0 {
+			t.Errorf("Expected the uploads of the %s phase to be reported separately", phase)
+		}
+	}
+	if _, ok := run.phases[phaseMeasured]; ok {
+		t.Errorf("Expected the measured phase to be reported as the results")
+	}
+	if run.results.Upload.Operations == 0 {
+		t.Errorf("Expected measured uploads")
+	}
+	if !run.start.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected the measurement to start after the warm-up")
+	}
+	if elapsed := run.elapsed(); elapsed < 2900*time.Millisecond || elapsed > 3500*time.Millisecond {
+		t.Errorf("Expected a measurement of about 3s but got %s", elapsed)
+	}
+}
+
+func TestPerformanceCancelPhaseAgainstMock(t *testing.T) {
+	target := newMockTarget(t, s3mock_server.Options{})
+	config := performanceConfig{VUs: 1, Duration: 5, CoolDown: 2, FileSize: "1KiB", Payload: "random"}
+	if err := config.validate(); err != nil {
+		t.Fatalf("Invalid configuration: %s", err)
+	}
+
+	// cancel in the second second of the measured phase
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	phases := []string{}
+	runPerformance(ctx, target, config, func(interval *performanceResults) {
+		phases = append(phases, interval.Phase)
+	})
+
+	if len(phases) != 3 {
+		t.Fatalf("Expected two intervals and the leftover interval but got %q", phases)
+	}
+	for i, phase := range phases {
+		if phase != phaseMeasured {
+			t.Errorf("Expected interval %d of the cancelled run to be measured but got '%s'", i, phase)
+		}
+	}
+}
+
+func TestCoordinateAgentsAgainstMock(t *testing.T) {
+	target := newMockTarget(t, s3mock_server.Options{Latency: time.Millisecond})
+	agents := make([]string, 2)
+	for i := range agents {
+		agent := httptest.NewServer(newAgentServer(target))
+		t.Cleanup(agent.Close)
+		agents[i] = agent.URL
+	}
+
+	mutex := sync.Mutex{}
+	results := &performanceResults{}
+	config := performanceConfig{VUs: 3, Duration: 1, FileSize: "4KiB", Payload: "zero", Verify: true}
+	err := coordinate(agents, config, 0, func(agent string, interval *performanceResults) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results.merge(interval)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected coordination error: %s", err)
+	}
+	if results.Download.Successes == 0 || results.Download.Successes != results.Download.Operations {
+		t.Errorf("Expected only successful downloads but got %d of %d", results.Download.Successes, results.Download.Operations)
+	}
+	if results.Download.Times.Min < 1 {
+		t.Errorf("Expected download times above the injected latency but got %.3fms", results.Download.Times.Min)
+	}
+}
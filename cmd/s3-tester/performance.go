@@ -0,0 +1,852 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/minio/minio-go/v7"
+	"github.com/mxcd/tester-toolbox/internal/payload"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/schollz/progressbar/v3"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// operationResults collects the samples of one S3 operation type.
+// Times are in milliseconds, speeds in bytes per second.
+type operationResults struct {
+	Times    util.Histogram `json:"times"`
+	Speeds   util.Histogram `json:"speeds"`
+	Attempts util.Histogram `json:"attempts"`
+
+	Operations            int `json:"operations"`
+	FirstAttemptSuccesses int `json:"firstAttemptSuccesses"`
+	Successes             int `json:"successes"`
+	Throttled             int `json:"throttled"`
+	// Errors counts failed operations by the kind of error
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// maxErrorKinds limits the distinct errors kept per operation so that
+// unexpected error messages cannot blow up the results.
+const maxErrorKinds = 20
+
+const otherErrors = "other errors"
+
+func (r *operationResults) record(elapsedTime time.Duration, size int64, tracker *attemptTracker, err error) {
+	attempts := tracker.attempts()
+	r.Operations++
+	r.Attempts.Record(float64(attempts))
+	r.Throttled += tracker.throttledResponses()
+	if err != nil {
+		r.recordErrors(errorKind(err), 1)
+		return
+	}
+	r.Successes++
+	if attempts == 1 {
+		r.FirstAttemptSuccesses++
+	}
+	r.Times.Record(float64(elapsedTime.Microseconds()) / 1000)
+	if size > 0 {
+		r.Speeds.Record(float64(size) / elapsedTime.Seconds())
+	}
+}
+
+func (r *operationResults) merge(other *operationResults) {
+	r.Times.Merge(&other.Times)
+	r.Speeds.Merge(&other.Speeds)
+	r.Attempts.Merge(&other.Attempts)
+	r.Operations += other.Operations
+	r.FirstAttemptSuccesses += other.FirstAttemptSuccesses
+	r.Successes += other.Successes
+	r.Throttled += other.Throttled
+	for kind, count := range other.Errors {
+		r.recordErrors(kind, count)
+	}
+}
+
+func (r *operationResults) recordErrors(kind string, count int) {
+	if r.Errors == nil {
+		r.Errors = make(map[string]int)
+	}
+	if _, ok := r.Errors[kind]; !ok && len(r.Errors) >= maxErrorKinds {
+		kind = otherErrors
+	}
+	r.Errors[kind] += count
+}
+
+// errorKind groups errors by their S3 error code or, for transport errors,
+// by the message without the request URL, which contains the object name.
+func errorKind(err error) string {
+	if response := minio.ToErrorResponse(err); response.Code != "" {
+		return response.Code
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+type operationSet struct {
+	Upload   operationResults `json:"upload"`
+	Download operationResults `json:"download"`
+	Delete   operationResults `json:"delete"`
+}
+
+func (s *operationSet) merge(other *operationSet) {
+	s.Upload.merge(&other.Upload)
+	s.Download.merge(&other.Download)
+	s.Delete.merge(&other.Delete)
+}
+
+// Phases of a run. Intervals of the measured phase have no phase.
+const (
+	phaseMeasured = ""
+	phaseWarmUp   = "warm-up"
+	phaseCoolDown = "cool-down"
+)
+
+type performanceResults struct {
+	operationSet
+	SizeClasses map[int64]*operationSet `json:"sizeClasses"`
+	// Phase is the phase of the run an interval belongs to
+	Phase string `json:"phase,omitempty"`
+}
+
+func (r *performanceResults) sizeClass(class int64) *operationSet {
+	if r.SizeClasses == nil {
+		r.SizeClasses = make(map[int64]*operationSet)
+	}
+	set, ok := r.SizeClasses[class]
+	if !ok {
+		set = &operationSet{}
+		r.SizeClasses[class] = set
+	}
+	return set
+}
+
+func (r *performanceResults) merge(other *performanceResults) {
+	r.operationSet.merge(&other.operationSet)
+	for class, set := range other.SizeClasses {
+		r.sizeClass(class).merge(set)
+	}
+}
+
+// operations counts all finished operations.
+func (r *performanceResults) operations() int {
+	return r.Upload.Operations + r.Download.Operations + r.Delete.Operations
+}
+
+// iterations counts successful uploads and deletes, which is what the progress bar shows.
+func (r *performanceResults) iterations() int {
+	return r.Upload.Successes + r.Delete.Successes
+}
+
+// performanceConfig describes a performance workload. Distributed runs send
+// it to the agents as JSON.
+type performanceConfig struct {
+	VUs int `json:"vus"`
+	// Duration, WarmUp and CoolDown are in seconds. Only the samples
+	// between warm-up and cool-down count towards the results.
+	Duration int    `json:"duration"`
+	WarmUp   int    `json:"warmUp,omitempty"`
+	CoolDown int    `json:"coolDown,omitempty"`
+	FileSize string `json:"fileSize"`
+	Payload  string `json:"payload"`
+	Seed     uint64 `json:"seed"`
+	Verify   bool   `json:"verify"`
+	// MaxErrors stops the run after more failed operations. 0 uses
+	// defaultMaxErrors, a negative value never stops the run.
+	MaxErrors int `json:"maxErrors,omitempty"`
+}
+
+const defaultMaxErrors = 100
+
+// workloadFlags configure what the virtual users of a run do.
+func workloadFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "vus",
+			Usage: "Virtual users",
+		},
+		&cli.StringFlag{
+			Name:  "filesize",
+			Usage: "File size or size distribution, e.g. '500KiB', '4KiB:60,1MiB:30,64MiB:10', '1KiB-10MiB' or 'lognormal:1MiB,1.5'",
+		},
+		&cli.StringFlag{
+			Name:  "payload",
+			Usage: "Payload mode: random, compressible, zero or block",
+			Value: "random",
+		},
+		&cli.Uint64Flag{
+			Name:  "seed",
+			Usage: "Payload seed. 0 uses a new seed per object, any other value uploads identical objects",
+		},
+		&cli.BoolFlag{
+			Name:  "verify",
+			Usage: "Verify downloaded objects against the regenerated payload",
+		},
+	}
+}
+
+func performanceFlags() []cli.Flag {
+	return append(workloadFlags(),
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "Duration of the measured phase, e.g. 90s or 15m",
+			Value: 30 * time.Second,
+		},
+		&cli.DurationFlag{
+			Name:  "warm-up",
+			Usage: "Run the workload for this long before measuring, e.g. 30s. Its samples are excluded from the results",
+		},
+		&cli.DurationFlag{
+			Name:  "cool-down",
+			Usage: "Keep running the workload for this long after measuring. Its samples are excluded from the results",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "Write the results as JSON to the given file, e.g. for compare",
+		},
+		&cli.StringFlag{
+			Name:  "html",
+			Usage: "Write a self-contained HTML report with charts to the given file",
+		},
+	)
+}
+
+// getWorkloadConfig reads the workloadFlags. The duration is left to the command.
+func getWorkloadConfig(c *cli.Context) performanceConfig {
+	config := performanceConfig{
+		VUs:      c.Int("vus"),
+		FileSize: c.String("filesize"),
+		Payload:  c.String("payload"),
+		Seed:     c.Uint64("seed"),
+		Verify:   c.Bool("verify"),
+	}
+	if config.VUs == 0 {
+		config.VUs = 1
+	}
+	if config.FileSize == "" {
+		config.FileSize = "500KiB"
+	}
+	return config
+}
+
+// durationSeconds converts a duration flag to whole seconds, the resolution of the results.
+func durationSeconds(c *cli.Context, name string) (int, error) {
+	duration := c.Duration(name)
+	if duration < 0 || duration%time.Second != 0 {
+		return 0, fmt.Errorf("--%s must be a non-negative whole number of seconds, got %s", name, duration)
+	}
+	return int(duration / time.Second), nil
+}
+
+func getPerformanceConfig(c *cli.Context) performanceConfig {
+	config := getWorkloadConfig(c)
+	var err error
+	for _, flag := range []struct {
+		name    string
+		seconds *int
+	}{
+		{"duration", &config.Duration},
+		{"warm-up", &config.WarmUp},
+		{"cool-down", &config.CoolDown},
+	} {
+		*flag.seconds, err = durationSeconds(c, flag.name)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid performance test configuration")
+		}
+	}
+	if err := config.validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid performance test configuration")
+	}
+	return config
+}
+
+func (config performanceConfig) validate() error {
+	if config.VUs < 1 {
+		return fmt.Errorf("at least 1 virtual user is required, got %d", config.VUs)
+	}
+	if config.Duration < 1 {
+		return fmt.Errorf("duration must be at least 1 second, got %d", config.Duration)
+	}
+	if config.WarmUp < 0 || config.CoolDown < 0 {
+		return fmt.Errorf("warm-up and cool-down must not be negative, got %d and %d seconds", config.WarmUp, config.CoolDown)
+	}
+	if config.Duration <= config.WarmUp+config.CoolDown {
+		return fmt.Errorf("duration must be longer than warm-up and cool-down together, got %d seconds for %d and %d seconds", config.Duration, config.WarmUp, config.CoolDown)
+	}
+	if _, err := util.ParseSizeDistribution(config.FileSize); err != nil {
+		return fmt.Errorf("failed to parse file size '%s': %w", config.FileSize, err)
+	}
+	if _, err := payload.ParseMode(config.Payload); err != nil {
+		return err
+	}
+	return nil
+}
+
+func performance(c *cli.Context) error {
+	config := getPerformanceConfig(c)
+	sizeDistribution, _ := util.ParseSizeDistribution(config.FileSize)
+	target := getS3Target(c)
+
+	log.Info().Msgf("Starting performance test with %d virtual users for %d seconds and %s files of %s with %s", config.VUs, config.Duration, config.Payload, sizeDistribution, sseLabel(target.sse))
+	logPhases(config)
+
+	shutdownTracing, err := setupTracing(c)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
+
+	observers := serveMetrics(c, config.VUs)
+
+	progress := progressbar.Default(-1)
+	run := newMeasurement(time.Now(), config)
+	runPerformance(context.Background(), target, config, func(interval *performanceResults) {
+		run.add(interval, time.Now())
+		progress.Add(interval.iterations())
+	}, observers...)
+	progress.Finish()
+
+	log.Info().Msg("Performance test finished")
+
+	title := fmt.Sprintf("%d VUs | %d seconds | %s file size | %s", config.VUs, config.Duration, sizeDistribution, sseLabel(target.sse))
+	renderPerformanceResults(run.results, title, sizeDistribution)
+	run.render()
+
+	writeReports(c, &performanceReport{
+		Start:       run.start,
+		Elapsed:     run.elapsed().Seconds(),
+		Endpoint:    fmt.Sprintf("%s:%d/%s", c.String("endpoint"), c.Int("port"), target.bucket),
+		SSE:         sseLabel(target.sse),
+		RetryPolicy: retryPolicyLabel(),
+		Config:      config,
+		Results:     run.results,
+		Phases:      run.report(),
+		Timeline:    run.timeline.points(),
+	})
+	return nil
+}
+
+// measurement collects the intervals of the measured phase of a run. The
+// warm-up and cool-down phases are collected on their own so that they can
+// be reported next to the steady state without skewing it.
+type measurement struct {
+	start    time.Time
+	end      time.Time
+	results  *performanceResults
+	timeline *timeline
+	phases   map[string]*performanceResults
+}
+
+// newMeasurement starts a measurement for a workload that starts at start.
+func newMeasurement(start time.Time, config performanceConfig) *measurement {
+	measuredStart := start.Add(time.Duration(config.WarmUp) * time.Second)
+	return &measurement{
+		start:    measuredStart,
+		end:      measuredStart,
+		results:  &performanceResults{},
+		timeline: newTimeline(measuredStart),
+		phases:   make(map[string]*performanceResults),
+	}
+}
+
+func (m *measurement) add(interval *performanceResults, now time.Time) {
+	if interval.Phase != phaseMeasured {
+		phase, ok := m.phases[interval.Phase]
+		if !ok {
+			phase = &performanceResults{Phase: interval.Phase}
+			m.phases[interval.Phase] = phase
+		}
+		phase.merge(interval)
+		return
+	}
+	m.results.merge(interval)
+	m.timeline.add(interval)
+	m.end = now
+}
+
+func (m *measurement) elapsed() time.Duration {
+	return m.end.Sub(m.start)
+}
+
+// report returns the excluded phases for the report, or nil if there were none.
+func (m *measurement) report() map[string]*performanceResults {
+	if len(m.phases) == 0 {
+		return nil
+	}
+	return m.phases
+}
+
+// render logs how many operations were excluded and compares the phases.
+func (m *measurement) render() {
+	if len(m.phases) == 0 {
+		return
+	}
+	for _, phase := range []string{phaseWarmUp, phaseCoolDown} {
+		if results, ok := m.phases[phase]; ok {
+			log.Info().Msgf("Excluded %d operations of the %s phase from the results", results.operations(), phase)
+		}
+	}
+	renderTable(phaseTable(m.results, m.phases))
+}
+
+// operationObserver is notified about every finished operation as it
+// happens, e.g. to export live metrics. It is called concurrently.
+type operationObserver interface {
+	observe(operation string, elapsedTime time.Duration, size int64, tracker *attemptTracker, err error)
+}
+
+// runPerformance runs the workload of config against the target until the
+// configured duration has passed, too many errors occurred or ctx is done.
+// The results are handed to onInterval once per second and once more for
+// the iterations that finished after the last full second.
+func runPerformance(ctx context.Context, target *s3Target, config performanceConfig, onInterval func(interval *performanceResults), observers ...operationObserver) {
+	sizeDistribution, _ := util.ParseSizeDistribution(config.FileSize)
+	payloadMode, _ := payload.ParseMode(config.Payload)
+
+	client := target.client
+	S3_BUCKET := target.bucket
+	sse := target.sse
+	mutex := sync.Mutex{}
+	interval := &performanceResults{}
+	errorCount := 0
+	maxErrors := config.MaxErrors
+	if maxErrors == 0 {
+		maxErrors = defaultMaxErrors
+	}
+
+	stop := false
+
+	performanceTest := func(random *rand.Rand) {
+		id := uuid.New().String()
+		byteFileSize := sizeDistribution.Sample(random)
+		sizeClass := sizeDistribution.SizeClass(byteFileSize)
+
+		seed := config.Seed
+		if seed == 0 {
+			seed = random.Uint64()
+		}
+		putOptions := minio.PutObjectOptions{
+			ContentType:          "application/octet-stream",
+			ServerSideEncryption: sse,
+			UserMetadata: map[string]string{
+				"payload-mode": string(payloadMode),
+				"payload-seed": strconv.FormatUint(seed, 10),
+			},
+		}
+
+		record := func(name string, operation func(set *operationSet) *operationResults, span trace.Span, elapsedTime time.Duration, size int64, tracker *attemptTracker, err error) {
+			endOperationSpan(span, tracker, err)
+			for _, observer := range observers {
+				observer.observe(name, elapsedTime, size, tracker, err)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			operation(&interval.operationSet).record(elapsedTime, size, tracker, err)
+			operation(interval.sizeClass(sizeClass)).record(elapsedTime, size, tracker, err)
+			if err != nil {
+				errorCount++
+			}
+		}
+
+		opCtx, tracker := withAttemptTracker(ctx)
+		opCtx, span := startOperationSpan(opCtx, "PutObject", S3_BUCKET, id, byteFileSize)
+		startTime := time.Now()
+		_, err := client.PutObject(opCtx, S3_BUCKET, id, payload.NewReader(payloadMode, seed, byteFileSize), byteFileSize, putOptions)
+		record("upload", uploadOperation, span, time.Since(startTime), byteFileSize, tracker, err)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to upload")
+			return
+		}
+
+		opCtx, tracker = withAttemptTracker(ctx)
+		opCtx, span = startOperationSpan(opCtx, "GetObject", S3_BUCKET, id, byteFileSize)
+		startTime = time.Now()
+		s3Object, err := client.GetObject(opCtx, S3_BUCKET, id, minio.GetObjectOptions{ServerSideEncryption: sse})
+		if err == nil {
+			var downloaded int64
+			if config.Verify {
+				verifier := payload.NewVerifier(payloadMode, seed, byteFileSize)
+				downloaded, err = io.Copy(verifier, s3Object)
+				if err == nil {
+					err = verifier.Verify()
+				}
+			} else {
+				downloaded, err = io.Copy(io.Discard, s3Object)
+			}
+			s3Object.Close()
+			log.Trace().Msgf("Downloaded %d bytes", downloaded)
+		}
+		record("download", downloadOperation, span, time.Since(startTime), byteFileSize, tracker, err)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to download object '%s'", id)
+			return
+		}
+
+		opCtx, tracker = withAttemptTracker(ctx)
+		opCtx, span = startOperationSpan(opCtx, "DeleteObject", S3_BUCKET, id, 0)
+		startTime = time.Now()
+		err = client.RemoveObject(opCtx, S3_BUCKET, id, minio.RemoveObjectOptions{})
+		record("delete", deleteOperation, span, time.Since(startTime), 0, tracker, err)
+		if err != nil {
+			log.Error().Err(err).Msgf("Failed to remove object '%s'", id)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+
+	worker := func(id int) {
+		defer wg.Done()
+		random := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+		for {
+			log.Trace().Msgf("Starting upload for worker %d", id)
+			performanceTest(random)
+			log.Trace().Msgf("Finished upload for worker %d", id)
+			mutex.Lock()
+			stopped := stop
+			mutex.Unlock()
+			if stopped {
+				return
+			}
+		}
+	}
+
+	for i := 0; i < config.VUs; i++ {
+		wg.Add(1)
+		go worker(i)
+	}
+
+	nextInterval := func(phase string) *performanceResults {
+		mutex.Lock()
+		defer mutex.Unlock()
+		finished := interval
+		finished.Phase = phase
+		interval = &performanceResults{}
+		return finished
+	}
+
+	phase := func(second int) string {
+		switch {
+		case second < config.WarmUp:
+			return phaseWarmUp
+		case second < config.WarmUp+config.Duration:
+			return phaseMeasured
+		default:
+			return phaseCoolDown
+		}
+	}
+
+	ticker := time.NewTicker(time.Second)
+	seconds := config.WarmUp + config.Duration + config.CoolDown
+	// lastPhase is the phase of the last interval, which differs from the
+	// last phase of the run if it stopped early
+	lastPhase := phase(0)
+	for i := 0; i < seconds; i++ {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+		lastPhase = phase(i)
+		onInterval(nextInterval(lastPhase))
+		if i+1 < seconds && phase(i+1) != phase(i) {
+			log.Info().Msgf("Finished %s phase", phaseLabel(phase(i)))
+		}
+		mutex.Lock()
+		tooManyErrors := maxErrors > 0 && errorCount > maxErrors
+		mutex.Unlock()
+		if tooManyErrors {
+			log.Error().Msg("Too many errors. Stopping performance test")
+			break
+		}
+		if ctx.Err() != nil {
+			log.Warn().Msg("Performance test cancelled")
+			break
+		}
+	}
+	ticker.Stop()
+
+	log.Info().Msg("Finalizing current worker jobs")
+	mutex.Lock()
+	stop = true
+	mutex.Unlock()
+
+	wg.Wait()
+	// operations that finish after the last second belong to its phase
+	onInterval(nextInterval(lastPhase))
+}
+
+func logPhases(config performanceConfig) {
+	if config.WarmUp > 0 || config.CoolDown > 0 {
+		log.Info().Msgf("Excluding a %d second warm-up and a %d second cool-down from the results", config.WarmUp, config.CoolDown)
+	}
+}
+
+func phaseLabel(phase string) string {
+	if phase == phaseMeasured {
+		return "measured"
+	}
+	return phase
+}
+
+func uploadOperation(set *operationSet) *operationResults   { return &set.Upload }
+func downloadOperation(set *operationSet) *operationResults { return &set.Download }
+func deleteOperation(set *operationSet) *operationResults   { return &set.Delete }
+
+// resultTable is a results table that is rendered both on the console and
+// in HTML reports. A nil row separates groups of rows.
+type resultTable struct {
+	title  string
+	header table.Row
+	rows   []table.Row
+}
+
+// performanceTables returns the tables of the results. retryPolicy describes
+// the retry settings the results were recorded with.
+func performanceTables(results *performanceResults, title string, sizeDistribution *util.SizeDistribution, retryPolicy string) []resultTable {
+	tables := []resultTable{
+		{
+			title:  fmt.Sprintf("S3 Performance Times | %s", title),
+			header: table.Row{"Operation", "T min [ms]", "T max [ms]", "P50 [ms]", "P90 [ms]", "P99 [ms]", "Mean [ms]", "Std Dev [ms]"},
+			rows: []table.Row{
+				timesRow("Upload Time", &results.Upload.Times),
+				timesRow("Download", &results.Download.Times),
+				timesRow("Delete", &results.Delete.Times),
+			},
+		},
+		{
+			title:  fmt.Sprintf("S3 Performance Speeds | %s", title),
+			header: table.Row{"Operation", "min [MB/s]", "max [MB/s]", "P50 [MB/s]", "P10 [MB/s]", "P1 [MB/s]", "Mean [MB/s]", "Std Dev [MB/s]"},
+			rows: []table.Row{
+				speedsRow("Upload Speed", &results.Upload.Speeds),
+				speedsRow("Download Speed", &results.Download.Speeds),
+			},
+		},
+	}
+
+	if !sizeDistribution.IsSingleSize() {
+		tables = append(tables, sizeClassTable(results, sizeDistribution))
+	}
+
+	tables = append(tables, resultTable{
+		title:  fmt.Sprintf("S3 Retries | %s", retryPolicy),
+		header: table.Row{"Operation", "Operations", "First Attempt [%]", "Eventual [%]", "Mean Attempts", "Max Attempts", "Throttled (503/429)"},
+		rows: []table.Row{
+			retriesRow("Upload", &results.Upload),
+			retriesRow("Download", &results.Download),
+			retriesRow("Delete", &results.Delete),
+		},
+	})
+
+	errorRows := append(append(errorRows("Upload", &results.Upload), errorRows("Download", &results.Download)...), errorRows("Delete", &results.Delete)...)
+	if len(errorRows) > 0 {
+		tables = append(tables, resultTable{
+			title:  "S3 Errors",
+			header: table.Row{"Operation", "Error", "Count", "Share [%]"},
+			rows:   errorRows,
+		})
+	}
+	return tables
+}
+
+// retryPolicyLabel describes the retry settings of the minio client.
+func retryPolicyLabel() string {
+	return fmt.Sprintf("%d max attempts | %s backoff unit | %s backoff cap", minio.MaxRetry, minio.DefaultRetryUnit, minio.DefaultRetryCap)
+}
+
+func renderPerformanceResults(results *performanceResults, title string, sizeDistribution *util.SizeDistribution) {
+	for _, resultTable := range performanceTables(results, title, sizeDistribution, retryPolicyLabel()) {
+		renderTable(resultTable)
+	}
+}
+
+func renderTable(resultTable resultTable) {
+	t := table.NewWriter()
+	t.SetTitle(resultTable.title)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(resultTable.header)
+	for _, row := range resultTable.rows {
+		if row == nil {
+			t.AppendSeparator()
+			continue
+		}
+		t.AppendRow(row)
+	}
+	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
+	t.Render()
+}
+
+// phaseTable compares the warm-up and cool-down phases with the measured
+// steady state, e.g. to see what connection setup and cold caches cost.
+func phaseTable(results *performanceResults, phases map[string]*performanceResults) resultTable {
+	rows := make([]table.Row, 0)
+	for _, phase := range []struct {
+		name    string
+		results *performanceResults
+	}{
+		{phaseWarmUp, phases[phaseWarmUp]},
+		{"measured", results},
+		{phaseCoolDown, phases[phaseCoolDown]},
+	} {
+		if phase.results == nil {
+			continue
+		}
+		if len(rows) > 0 {
+			rows = append(rows, nil)
+		}
+		rows = append(rows,
+			phaseRow(phase.name, "Upload", &phase.results.Upload),
+			phaseRow(phase.name, "Download", &phase.results.Download),
+			phaseRow(phase.name, "Delete", &phase.results.Delete),
+		)
+	}
+	return resultTable{
+		title:  "S3 Phases | only the measured phase counts towards the results",
+		header: table.Row{"Phase", "Operation", "Operations", "Success [%]", "P50 [ms]", "P99 [ms]", "Mean [ms]", "Mean [MB/s]"},
+		rows:   rows,
+	}
+}
+
+func phaseRow(phase string, operation string, results *operationResults) table.Row {
+	return table.Row{
+		phase,
+		operation,
+		results.Operations,
+		fmt.Sprintf("%.1f", percentage(results.Successes, results.Operations)),
+		fmt.Sprintf("%.1f", results.Times.Percentile(50)),
+		fmt.Sprintf("%.1f", results.Times.Percentile(99)),
+		fmt.Sprintf("%.1f", results.Times.Mean()),
+		fmt.Sprintf("%.2f", results.Speeds.Mean()/1000000),
+	}
+}
+
+func sizeClassTable(results *performanceResults, sizeDistribution *util.SizeDistribution) resultTable {
+	classes := make([]int64, 0, len(results.SizeClasses))
+	for class := range results.SizeClasses {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+
+	rows := make([]table.Row, 0, len(classes)*4)
+	for i, class := range classes {
+		if i > 0 {
+			rows = append(rows, nil)
+		}
+		set := results.SizeClasses[class]
+		label := sizeDistribution.SizeClassLabel(class)
+		rows = append(rows,
+			sizeClassRow(label, "Upload", &set.Upload),
+			sizeClassRow(label, "Download", &set.Download),
+			sizeClassRow(label, "Delete", &set.Delete),
+		)
+	}
+	return resultTable{
+		title:  fmt.Sprintf("S3 Performance by Size Class | %s", sizeDistribution),
+		header: table.Row{"Size Class", "Operation", "Count", "P50 [ms]", "P90 [ms]", "P99 [ms]", "Mean [ms]", "P50 [MB/s]", "Mean [MB/s]"},
+		rows:   rows,
+	}
+}
+
+func sizeClassRow(class string, operation string, results *operationResults) table.Row {
+	return table.Row{
+		class,
+		operation,
+		results.Times.Count,
+		fmt.Sprintf("%.1f", results.Times.Percentile(50)),
+		fmt.Sprintf("%.1f", results.Times.Percentile(90)),
+		fmt.Sprintf("%.1f", results.Times.Percentile(99)),
+		fmt.Sprintf("%.1f", results.Times.Mean()),
+		fmt.Sprintf("%.2f", results.Speeds.Percentile(50)/1000000),
+		fmt.Sprintf("%.2f", results.Speeds.Mean()/1000000),
+	}
+}
+
+func timesRow(operation string, times *util.Histogram) table.Row {
+	return table.Row{
+		operation,
+		fmt.Sprintf("%.1f", times.Min),
+		fmt.Sprintf("%.1f", times.Max),
+		fmt.Sprintf("%.1f", times.Percentile(50)),
+		fmt.Sprintf("%.1f", times.Percentile(90)),
+		fmt.Sprintf("%.1f", times.Percentile(99)),
+		fmt.Sprintf("%.1f", times.Mean()),
+		fmt.Sprintf("%.1f", times.StdDev()),
+	}
+}
+
+func speedsRow(operation string, speeds *util.Histogram) table.Row {
+	return table.Row{
+		operation,
+		fmt.Sprintf("%.2f", speeds.Min/1000000),
+		fmt.Sprintf("%.2f", speeds.Max/1000000),
+		fmt.Sprintf("%.2f", speeds.Percentile(50)/1000000),
+		fmt.Sprintf("%.2f", speeds.Percentile(10)/1000000),
+		fmt.Sprintf("%.2f", speeds.Percentile(1)/1000000),
+		fmt.Sprintf("%.2f", speeds.Mean()/1000000),
+		fmt.Sprintf("%.2f", speeds.StdDev()/1000000),
+	}
+}
+
+func retriesRow(operation string, results *operationResults) table.Row {
+	return table.Row{
+		operation,
+		results.Operations,
+		fmt.Sprintf("%.1f", percentage(results.FirstAttemptSuccesses, results.Operations)),
+		fmt.Sprintf("%.1f", percentage(results.Successes, results.Operations)),
+		fmt.Sprintf("%.2f", results.Attempts.Mean()),
+		fmt.Sprintf("%.0f", results.Attempts.Max),
+		results.Throttled,
+	}
+}
+
+// errorRows lists the errors of an operation, most frequent first.
+func errorRows(operation string, results *operationResults) []table.Row {
+	kinds := make([]string, 0, len(results.Errors))
+	for kind := range results.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if results.Errors[kinds[i]] != results.Errors[kinds[j]] {
+			return results.Errors[kinds[i]] > results.Errors[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	rows := make([]table.Row, 0, len(kinds))
+	for _, kind := range kinds {
+		rows = append(rows, table.Row{
+			operation,
+			kind,
+			results.Errors[kind],
+			fmt.Sprintf("%.1f", percentage(results.Errors[kind], results.Operations)),
+		})
+	}
+	return rows
+}
+
+func percentage(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
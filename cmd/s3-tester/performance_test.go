@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestPerformanceConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config performanceConfig
+		valid  bool
+	}{
+		{"measured only", performanceConfig{VUs: 1, Duration: 1}, true},
+		{"with phases", performanceConfig{VUs: 1, Duration: 60, WarmUp: 30, CoolDown: 10}, true},
+		{"zero duration", performanceConfig{VUs: 1, Duration: 0}, false},
+		{"as long as the phases", performanceConfig{VUs: 1, Duration: 40, WarmUp: 30, CoolDown: 10}, false},
+		{"negative warm-up", performanceConfig{VUs: 1, Duration: 10, WarmUp: -1}, false},
+		{"no virtual users", performanceConfig{VUs: 0, Duration: 10}, false},
+	}
+	for _, test := range tests {
+		test.config.FileSize = "1KiB"
+		test.config.Payload = "random"
+		err := test.config.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("Expected the configuration '%s' to be valid %t but got %v", test.name, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const performanceReportVersion = 1
+
+// performanceReport is the JSON export of a performance run written with
+// --output. It keeps the full histograms so that runs can be compared later.
+type performanceReport struct {
+	Version  int       `json:"version"`
+	Start    time.Time `json:"start"`
+	Elapsed  float64   `json:"elapsed"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	Agents   int       `json:"agents,omitempty"`
+	SSE      string    `json:"sse,omitempty"`
+	// RetryPolicy describes the retry settings of the run
+	RetryPolicy string              `json:"retryPolicy,omitempty"`
+	Config      performanceConfig   `json:"config"`
+	Results     *performanceResults `json:"results"`
+	// Phases holds the warm-up and cool-down results excluded from Results
+	Phases   map[string]*performanceResults `json:"phases,omitempty"`
+	Timeline []timelinePoint                `json:"timeline,omitempty"`
+}
+
+// timelinePoint summarizes the operations that finished in one second of a run.
+type timelinePoint struct {
+	Second   int               `json:"second"`
+	Upload   timelineOperation `json:"upload"`
+	Download timelineOperation `json:"download"`
+	Delete   timelineOperation `json:"delete"`
+}
+
+// timelineOperation holds the latency in milliseconds and the mean speed in
+// bytes per second of one operation type within a second.
+type timelineOperation struct {
+	Operations int     `json:"operations"`
+	Successes  int     `json:"successes"`
+	P50        float64 `json:"p50"`
+	P99        float64 `json:"p99"`
+	Speed      float64 `json:"speed"`
+}
+
+func newTimelineOperation(results *operationResults) timelineOperation {
+	return timelineOperation{
+		Operations: results.Operations,
+		Successes:  results.Successes,
+		P50:        results.Times.Percentile(50),
+		P99:        results.Times.Percentile(99),
+		Speed:      results.Speeds.Mean(),
+	}
+}
+
+func uploadTimeline(point *timelinePoint) *timelineOperation   { return &point.Upload }
+func downloadTimeline(point *timelinePoint) *timelineOperation { return &point.Download }
+func deleteTimeline(point *timelinePoint) *timelineOperation   { return &point.Delete }
+
+// timeline collects interval results by the second of the run they arrive
+// in. Intervals of several agents that arrive in the same second are merged.
+type timeline struct {
+	start   time.Time
+	seconds map[int]*operationSet
+}
+
+func newTimeline(start time.Time) *timeline {
+	return &timeline{start: start, seconds: make(map[int]*operationSet)}
+}
+
+func (t *timeline) add(interval *performanceResults) {
+	second := int(math.Round(time.Since(t.start).Seconds()))
+	if second < 0 {
+		second = 0
+	}
+	set, ok := t.seconds[second]
+	if !ok {
+		set = &operationSet{}
+		t.seconds[second] = set
+	}
+	set.merge(&interval.operationSet)
+}
+
+func (t *timeline) points() []timelinePoint {
+	seconds := make([]int, 0, len(t.seconds))
+	for second := range t.seconds {
+		seconds = append(seconds, second)
+	}
+	sort.Ints(seconds)
+
+	points := make([]timelinePoint, 0, len(seconds))
+	for _, second := range seconds {
+		set := t.seconds[second]
+		points = append(points, timelinePoint{
+			Second:   second,
+			Upload:   newTimelineOperation(&set.Upload),
+			Download: newTimelineOperation(&set.Download),
+			Delete:   newTimelineOperation(&set.Delete),
+		})
+	}
+	return points
+}
+
+// throughput returns the successful operations per second of the run.
+func (r *performanceReport) throughput(results *operationResults) float64 {
+	elapsed := r.Elapsed
+	if elapsed <= 0 {
+		elapsed = float64(r.Config.Duration)
+	}
+	return float64(results.Successes) / elapsed
+}
+
+func writePerformanceReport(path string, report *performanceReport) error {
+	report.Version = performanceReportVersion
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readPerformanceReport(path string) (*performanceReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &performanceReport{}
+	err = json.Unmarshal(data, report)
+	if err != nil {
+		return nil, fmt.Errorf("invalid performance report '%s': %w", path, err)
+	}
+	if report.Version != performanceReportVersion {
+		return nil, fmt.Errorf("unsupported performance report version %d in '%s'", report.Version, path)
+	}
+	if report.Results == nil {
+		return nil, fmt.Errorf("performance report '%s' has no results", path)
+	}
+	return report, nil
+}
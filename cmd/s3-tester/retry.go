@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// attemptTracker counts the HTTP requests the minio client sends on behalf of
+// a single operation. Retries of a request hit the same method and URL again,
+// so the highest count of any request is the number of attempts needed.
+type attemptTracker struct {
+	mutex     sync.Mutex
+	requests  map[string]int
+	throttled int
+}
+
+type attemptTrackerKey struct{}
+
+func withAttemptTracker(ctx context.Context) (context.Context, *attemptTracker) {
+	tracker := &attemptTracker{requests: make(map[string]int)}
+	return context.WithValue(ctx, attemptTrackerKey{}, tracker), tracker
+}
+
+func (t *attemptTracker) record(req *http.Request) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.requests[req.Method+" "+req.URL.String()]++
+}
+
+func (t *attemptTracker) recordThrottled() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.throttled++
+}
+
+func (t *attemptTracker) attempts() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	attempts := 1
+	for _, count := range t.requests {
+		if count > attempts {
+			attempts = count
+		}
+	}
+	return attempts
+}
+
+func (t *attemptTracker) throttledResponses() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.throttled
+}
+
+// attemptTransport feeds every request and throttling response into the
+// attemptTracker stored in the request context, if there is one.
+type attemptTransport struct {
+	base http.RoundTripper
+}
+
+func (t *attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tracker, ok := req.Context().Value(attemptTrackerKey{}).(*attemptTracker)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	tracker.record(req)
+	res, err := t.base.RoundTrip(req)
+	if err == nil && (res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusTooManyRequests) {
+		log.Debug().Msgf("Throttled with status %d on %s %s", res.StatusCode, req.Method, req.URL.Path)
+		tracker.recordThrottled()
+	}
+	return res, err
+}
+
+// requestTimeoutError is returned for requests that exceeded the request
+// timeout. Unlike context.DeadlineExceeded, minio retries it.
+type requestTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *requestTimeoutError) Error() string {
+	return fmt.Sprintf("request timed out after %s", e.timeout)
+}
+
+// timeoutTransport limits every HTTP request including reading its response
+// body to timeout, so that a hanging request is retried instead of blocking
+// its virtual user.
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent := req.Context()
+	ctx, cancel := context.WithTimeout(parent, t.timeout)
+	res, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, t.timeoutError(parent, ctx, err)
+	}
+	res.Body = &timeoutBody{ReadCloser: res.Body, transport: t, parent: parent, ctx: ctx, cancel: cancel}
+	return res, nil
+}
+
+// timeoutError replaces err if the request timed out rather than its
+// operation being cancelled.
+func (t *timeoutTransport) timeoutError(parent context.Context, ctx context.Context, err error) error {
+	if parent.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &requestTimeoutError{timeout: t.timeout}
+	}
+	return err
+}
+
+type timeoutBody struct {
+	io.ReadCloser
+	transport *timeoutTransport
+	parent    context.Context
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = b.transport.timeoutError(b.parent, b.ctx, err)
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+func applyRetryPolicy(c *cli.Context) {
+	maxAttempts := c.Int("max-attempts")
+	if maxAttempts < 1 {
+		log.Fatal().Msgf("Max attempts must be at least 1, got %d", maxAttempts)
+	}
+	retryUnit := c.Duration("retry-unit")
+	retryCap := c.Duration("retry-cap")
+	if retryUnit <= 0 || retryCap < retryUnit {
+		log.Fatal().Msgf("Invalid retry backoff: unit '%s' must be positive and not exceed cap '%s'", retryUnit, retryCap)
+	}
+
+	minio.MaxRetry = maxAttempts
+	minio.DefaultRetryUnit = retryUnit
+	minio.DefaultRetryCap = retryCap
+	log.Debug().Msgf("Retry policy: %d max attempts, backoff unit %s, backoff cap %s", maxAttempts, retryUnit, retryCap)
+}
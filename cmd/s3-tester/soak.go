@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+const soakSummaryFile = "summary.jsonl"
+
+func soakFlags() []cli.Flag {
+	return append(workloadFlags(),
+		&cli.DurationFlag{
+			Name:  "duration",
+			Usage: "Duration of the soak test, e.g. 72h",
+			Value: 24 * time.Hour,
+		},
+		&cli.DurationFlag{
+			Name:  "window",
+			Usage: "Length of the windows that are summarized, written and compared for drift",
+			Value: 10 * time.Minute,
+		},
+		&cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory for the window results and the summary lines",
+			Value: "soak-results",
+		},
+		&cli.IntFlag{
+			Name:  "keep",
+			Usage: "Number of window result files to keep, 0 keeps all",
+			Value: 48,
+		},
+		&cli.Float64Flag{
+			Name:  "drift-threshold",
+			Usage: "Rise of a P99 latency in percent compared with the first window that counts as drift",
+			Value: 20,
+		},
+		&cli.BoolFlag{
+			Name:  "fail-on-drift",
+			Usage: "Exit with status 1 if any window drifted",
+		},
+	)
+}
+
+// soakMemory is the resource usage of the tester itself.
+type soakMemory struct {
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+	Goroutines int    `json:"goroutines"`
+}
+
+func readSoakMemory() soakMemory {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return soakMemory{
+		HeapAlloc:  stats.HeapAlloc,
+		Sys:        stats.Sys,
+		NumGC:      stats.NumGC,
+		Goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// soakSummary is written as one JSON line per window.
+type soakSummary struct {
+	Window   int               `json:"window"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Upload   timelineOperation `json:"upload"`
+	Download timelineOperation `json:"download"`
+	Delete   timelineOperation `json:"delete"`
+	Memory   soakMemory        `json:"memory"`
+	// Drift lists the P99 latencies that rose beyond the threshold
+	Drift []string `json:"drift,omitempty"`
+}
+
+// soakRun splits a long run into windows of a fixed number of intervals.
+// Every window is summarized and written on its own, so that memory use
+// does not depend on the duration and results are available while the run
+// goes on.
+type soakRun struct {
+	config         performanceConfig
+	windowSeconds  int
+	outputDir      string
+	keep           int
+	driftThreshold float64
+	readMemory     func() soakMemory
+
+	window      *performanceResults
+	windowStart time.Time
+	seconds     int
+	summaries   []soakSummary
+	baseline    *soakSummary
+	total       *performanceResults
+	files       []string
+}
+
+func newSoakRun(config performanceConfig, window time.Duration, outputDir string, keep int, driftThreshold float64, start time.Time) *soakRun {
+	return &soakRun{
+		config:         config,
+		windowSeconds:  int(window.Round(time.Second).Seconds()),
+		outputDir:      outputDir,
+		keep:           keep,
+		driftThreshold: driftThreshold,
+		readMemory:     readSoakMemory,
+		window:         &performanceResults{},
+		windowStart:    start,
+		total:          &performanceResults{},
+	}
+}
+
+// add merges an interval and closes the window once it is full.
+func (s *soakRun) add(interval *performanceResults, now time.Time) error {
+	s.window.merge(interval)
+	s.total.merge(interval)
+	s.seconds++
+	if s.seconds < s.windowSeconds {
+		return nil
+	}
+	return s.closeWindow(now)
+}
+
+// finish closes the last, partial window if anything ran in it.
+func (s *soakRun) finish(now time.Time) error {
+	if s.window.Upload.Operations == 0 && s.window.Download.Operations == 0 && s.window.Delete.Operations == 0 {
+		return nil
+	}
+	return s.closeWindow(now)
+}
+
+func (s *soakRun) closeWindow(now time.Time) error {
+	summary := soakSummary{
+		Window:   len(s.summaries) + 1,
+		Start:    s.windowStart,
+		End:      now,
+		Upload:   newTimelineOperation(&s.window.Upload),
+		Download: newTimelineOperation(&s.window.Download),
+		Delete:   newTimelineOperation(&s.window.Delete),
+		Memory:   s.readMemory(),
+	}
+	if s.baseline == nil {
+		s.baseline = &summary
+	} else {
+		summary.Drift = soakDrift(s.baseline, &summary, s.driftThreshold)
+	}
+	s.summaries = append(s.summaries, summary)
+	logSoakSummary(&summary)
+
+	config := s.config
+	config.Duration = s.seconds
+	err := s.writeWindow(&summary, &performanceReport{
+		Start:       s.windowStart,
+		Elapsed:     now.Sub(s.windowStart).Seconds(),
+		RetryPolicy: retryPolicyLabel(),
+		Config:      config,
+		Results:     s.window,
+	})
+
+	s.window = &performanceResults{}
+	s.windowStart = now
+	s.seconds = 0
+	return err
+}
+
+// writeWindow appends the summary line and writes the window results,
+// removing the oldest window files beyond keep.
+func (s *soakRun) writeWindow(summary *soakSummary, report *performanceReport) error {
+	line, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(s.outputDir, soakSummaryFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.outputDir, fmt.Sprintf("window-%05d.json", summary.Window))
+	err = writePerformanceReport(path, report)
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, path)
+	for s.keep > 0 && len(s.files) > s.keep {
+		err = os.Remove(s.files[0])
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.files = s.files[1:]
+	}
+	return nil
+}
+
+func (s *soakRun) drifted() int {
+	drifted := 0
+	for _, summary := range s.summaries {
+		if len(summary.Drift) > 0 {
+			drifted++
+		}
+	}
+	return drifted
+}
+
+// soakDrift compares the P99 latencies of a window with the first one.
+func soakDrift(baseline *soakSummary, current *soakSummary, threshold float64) []string {
+	operations := []struct {
+		name     string
+		baseline timelineOperation
+		current  timelineOperation
+	}{
+		{"Upload", baseline.Upload, current.Upload},
+		{"Download", baseline.Download, current.Download},
+		{"Delete", baseline.Delete, current.Delete},
+	}
+	drift := make([]string, 0)
+	for _, operation := range operations {
+		if operation.baseline.Successes == 0 || operation.current.Successes == 0 {
+			continue
+		}
+		change := relativeChange(operation.baseline.P99, operation.current.P99)
+		if change > threshold {
+			drift = append(drift, fmt.Sprintf("%s P99 %+.1f%% (%.1f ms to %.1f ms)", operation.name, change, operation.baseline.P99, operation.current.P99))
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+func logSoakSummary(summary *soakSummary) {
+	for _, operation := range []struct {
+		name    string
+		results timelineOperation
+	}{
+		{"Upload", summary.Upload},
+		{"Download", summary.Download},
+		{"Delete", summary.Delete},
+	} {
+		log.Info().Msgf("Window %d | %-8s | %d operations | %.1f%% errors | P50 %.1f ms | P99 %.1f ms | %.2f MB/s",
+			summary.Window, operation.name, operation.results.Operations, percentage(operation.results.Operations-operation.results.Successes, operation.results.Operations),
+			operation.results.P50, operation.results.P99, operation.results.Speed/1000000)
+	}
+	log.Info().Msgf("Window %d | tester uses %.1f MiB heap, %.1f MiB from the OS, %d goroutines after %d GCs",
+		summary.Window, float64(summary.Memory.HeapAlloc)/(1<<20), float64(summary.Memory.Sys)/(1<<20), summary.Memory.Goroutines, summary.Memory.NumGC)
+	for _, drift := range summary.Drift {
+		log.Warn().Msgf("Window %d | drift: %s", summary.Window, drift)
+	}
+}
+
+func soak(c *cli.Context) error {
+	config := getWorkloadConfig(c)
+	duration := c.Duration("duration")
+	window := c.Duration("window")
+	if window < time.Second || duration < window {
+		log.Fatal().Msgf("The window must be at least 1s and not exceed the duration, got %s and %s", window, duration)
+	}
+	config.Duration = int(duration.Round(time.Second).Seconds())
+	// a soak test reports errors per window instead of giving up
+	config.MaxErrors = -1
+	if err := config.validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid soak test configuration")
+	}
+	sizeDistribution, _ := util.ParseSizeDistribution(config.FileSize)
+	target := getS3Target(c)
+
+	outputDir := c.String("output-dir")
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to create output directory '%s'", outputDir)
+	}
+
+	log.Info().Msgf("Starting soak test with %d virtual users for %s and %s files of %s with %s, summarizing every %s to '%s'",
+		config.VUs, duration, config.Payload, sizeDistribution, sseLabel(target.sse), window, outputDir)
+
+	shutdownTracing, err := setupTracing(c)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up tracing")
+	}
+	defer func() {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to flush traces")
+		}
+	}()
+	observers := serveMetrics(c, config.VUs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	run := newSoakRun(config, window, outputDir, c.Int("keep"), c.Float64("drift-threshold"), start)
+	runPerformance(ctx, target, config, func(interval *performanceResults) {
+		err := run.add(interval, time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to write soak window")
+		}
+	}, observers...)
+	err = run.finish(time.Now())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to write soak window")
+	}
+
+	log.Info().Msgf("Soak test finished after %s", time.Since(start).Round(time.Second))
+	title := fmt.Sprintf("%d VUs | %s soak | %s file size | %s", config.VUs, time.Since(start).Round(time.Second), sizeDistribution, sseLabel(target.sse))
+	renderPerformanceResults(run.total, title, sizeDistribution)
+
+	drifted := run.drifted()
+	if drifted > 0 {
+		message := fmt.Sprintf("%d of %d windows drifted beyond %.1f%%", drifted, len(run.summaries), c.Float64("drift-threshold"))
+		if c.Bool("fail-on-drift") {
+			return cli.Exit(message, 1)
+		}
+		log.Warn().Msg(message)
+	}
+	return nil
+}
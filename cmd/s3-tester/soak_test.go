@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+)
+
+func soakInterval(upload time.Duration) *performanceResults {
+	interval := &performanceResults{}
+	tracker := &attemptTracker{requests: map[string]int{}}
+	for i := 0; i < 10; i++ {
+		interval.Upload.record(upload, 1000000, tracker, nil)
+		interval.Delete.record(10*time.Millisecond, 0, tracker, nil)
+	}
+	return interval
+}
+
+func readSoakSummaries(t *testing.T, dir string) []soakSummary {
+	file, err := os.Open(filepath.Join(dir, soakSummaryFile))
+	if err != nil {
+		t.Fatalf("Failed to open summaries: %s", err)
+	}
+	defer file.Close()
+	summaries := make([]soakSummary, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		summary := soakSummary{}
+		err := json.Unmarshal(scanner.Bytes(), &summary)
+		if err != nil {
+			t.Fatalf("Invalid summary line '%s': %s", scanner.Text(), err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func TestSoakRun(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := performanceConfig{VUs: 1, Duration: 600, FileSize: "1MB", Payload: "random"}
+	run := newSoakRun(config, 3*time.Second, dir, 2, 20, start)
+	run.readMemory = func() soakMemory { return soakMemory{HeapAlloc: 1 << 20, Goroutines: 5} }
+
+	// three windows at 100ms, then one at 150ms and a partial one
+	now := start
+	for i, upload := range []time.Duration{100, 100, 100, 100, 100, 100, 100, 100, 100, 150, 150, 150, 100} {
+		now = start.Add(time.Duration(i+1) * time.Second)
+		err := run.add(soakInterval(upload*time.Millisecond), now)
+		if err != nil {
+			t.Fatalf("Failed to add interval: %s", err)
+		}
+	}
+	err := run.finish(now)
+	if err != nil {
+		t.Fatalf("Failed to finish: %s", err)
+	}
+
+	summaries := readSoakSummaries(t, dir)
+	if len(summaries) != 5 {
+		t.Fatalf("Expected 5 windows but got %d", len(summaries))
+	}
+	if summaries[0].Upload.Operations != 30 || summaries[4].Upload.Operations != 10 || summaries[0].Memory.Goroutines != 5 {
+		t.Errorf("Expected full windows of 30 uploads and a partial one of 10 but got %+v", summaries)
+	}
+	if !summaries[1].End.Equal(start.Add(6*time.Second)) || !summaries[1].Start.Equal(start.Add(3*time.Second)) {
+		t.Errorf("Expected the second window from 3s to 6s but got %s to %s", summaries[1].Start, summaries[1].End)
+	}
+	for i, summary := range summaries {
+		drifted := len(summary.Drift) > 0
+		if drifted != (i == 3) {
+			t.Errorf("Expected only window 4 to drift but window %d has %v", i+1, summary.Drift)
+		}
+	}
+	if run.drifted() != 1 || run.total.Upload.Operations != 130 {
+		t.Errorf("Expected 1 drifted window and 130 uploads in total but got %d and %d", run.drifted(), run.total.Upload.Operations)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "window-*.json"))
+	if len(files) != 2 || filepath.Base(files[0]) != "window-00004.json" {
+		t.Fatalf("Expected the last 2 window files but got %v", files)
+	}
+	report, err := readPerformanceReport(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read window: %s", err)
+	}
+	if report.Config.Duration != 3 || report.Results.Upload.Operations != 30 {
+		t.Errorf("Expected a window of 3 seconds and 30 uploads but got %d and %d", report.Config.Duration, report.Results.Upload.Operations)
+	}
+}
+
+func TestSoakKeepsRunningOnErrors(t *testing.T) {
+	useFastRetries(t)
+	minio.MaxRetry = 1
+	dir := t.TempDir()
+	target := newMockTarget(t, s3mock_server.Options{ErrorRate: 1})
+	config := performanceConfig{VUs: 2, Duration: 2, FileSize: "4KiB", Payload: "random", MaxErrors: -1}
+	run := newSoakRun(config, time.Second, dir, 0, 20, time.Now())
+	runPerformance(context.Background(), target, config, func(interval *performanceResults) {
+		err := run.add(interval, time.Now())
+		if err != nil {
+			t.Errorf("Failed to add interval: %s", err)
+		}
+	})
+	run.finish(time.Now())
+
+	summaries := readSoakSummaries(t, dir)
+	if len(summaries) < 2 || summaries[1].Upload.Operations == 0 {
+		t.Fatalf("Expected the run to go on for 2 windows but got %+v", summaries)
+	}
+	if run.total.Upload.Operations <= defaultMaxErrors || run.total.Upload.Successes != 0 {
+		t.Errorf("Expected more than %d failed uploads but got %d of %d", defaultMaxErrors, run.total.Upload.Operations-run.total.Upload.Successes, run.total.Upload.Operations)
+	}
+}
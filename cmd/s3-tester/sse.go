@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// parseServerSideEncryption parses the --sse flag. Supported values are
+// 's3', 'kms:<key-id>' and 'c:<base64 encoded 256 bit key>'.
+func parseServerSideEncryption(sseStr string) (encrypt.ServerSide, error) {
+	if sseStr == "" {
+		return nil, nil
+	}
+	sseType, parameter, _ := strings.Cut(sseStr, ":")
+	switch strings.ToLower(sseType) {
+	case "s3":
+		return encrypt.NewSSE(), nil
+	case "kms":
+		if parameter == "" {
+			return nil, fmt.Errorf("SSE-KMS requires a key id, e.g. 'kms:my-key'")
+		}
+		return encrypt.NewSSEKMS(parameter, nil)
+	case "c":
+		key, err := base64.StdEncoding.DecodeString(parameter)
+		if err != nil {
+			return nil, fmt.Errorf("SSE-C key is not valid base64: %w", err)
+		}
+		return encrypt.NewSSEC(key)
+	default:
+		return nil, fmt.Errorf("server-side encryption '%s' not recognized, use 's3', 'kms:<key-id>' or 'c:<base64key>'", sseStr)
+	}
+}
+
+func getServerSideEncryption(c *cli.Context) encrypt.ServerSide {
+	sse, err := parseServerSideEncryption(c.String("sse"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server-side encryption")
+	}
+	if sse != nil {
+		log.Info().Msgf("Using server-side encryption %s", sse.Type())
+	}
+	return sse
+}
+
+func sseLabel(sse encrypt.ServerSide) string {
+	if sse == nil {
+		return "no SSE"
+	}
+	if sse.Type() == encrypt.SSEC {
+		return string(sse.Type())
+	}
+	return "SSE-" + string(sse.Type())
+}
+
+func newRandomSSEC() encrypt.ServerSide {
+	key := make([]byte, 32)
+	rand.Read(key)
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create SSE-C key")
+	}
+	return sse
+}
+
+// sseCheck verifies that objects encrypted with a customer provided key
+// cannot be read or inspected without that key.
+func sseCheck(c *cli.Context) error {
+	client := getS3Client(c)
+	S3_BUCKET := c.String("bucket")
+
+	sse := getServerSideEncryption(c)
+	if sse == nil || sse.Type() != encrypt.SSEC {
+		log.Info().Msg("No SSE-C key configured, using a random key")
+		sse = newRandomSSEC()
+	}
+	wrongKey := newRandomSSEC()
+
+	id := uuid.New().String()
+	content := make([]byte, 64*1024)
+	rand.Read(content)
+
+	_, err := client.PutObject(context.Background(), S3_BUCKET, id, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{ContentType: "application/octet-stream", ServerSideEncryption: sse})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to upload SSE-C object")
+		return err
+	}
+	defer func() {
+		err := client.RemoveObject(context.Background(), S3_BUCKET, id, minio.RemoveObjectOptions{})
+		if err != nil {
+			log.Warn().Err(err).Msgf("Failed to remove object '%s'", id)
+		}
+	}()
+
+	read := func(sse encrypt.ServerSide) ([]byte, error) {
+		object, err := client.GetObject(context.Background(), S3_BUCKET, id, minio.GetObjectOptions{ServerSideEncryption: sse})
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+		return io.ReadAll(object)
+	}
+	stat := func(sse encrypt.ServerSide) error {
+		_, err := client.StatObject(context.Background(), S3_BUCKET, id, minio.StatObjectOptions{ServerSideEncryption: sse})
+		return err
+	}
+
+	checks := []conformanceCheck{
+		{"GET without key is rejected", func() error { return expectFailure(read(nil)) }},
+		{"GET with wrong key is rejected", func() error { return expectFailure(read(wrongKey)) }},
+		{"HEAD without key is rejected", func() error { return expectFailure(nil, stat(nil)) }},
+		{"HEAD with wrong key is rejected", func() error { return expectFailure(nil, stat(wrongKey)) }},
+		{"HEAD with key succeeds", func() error { return stat(sse) }},
+		{"GET with key returns the content", func() error {
+			data, err := read(sse)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(data, content) {
+				return fmt.Errorf("content mismatch")
+			}
+			return nil
+		}},
+	}
+
+	failures := runConformanceChecks(fmt.Sprintf("S3 SSE-C Conformance | %s", S3_BUCKET), checks)
+	if failures > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d SSE-C checks failed", failures, len(checks)), 1)
+	}
+	return nil
+}
+
+type conformanceCheck struct {
+	name string
+	run  func() error
+}
+
+// runConformanceChecks runs all checks, renders their results and returns the number of failed checks.
+func runConformanceChecks(title string, checks []conformanceCheck) int {
+	t := table.NewWriter()
+	t.SetTitle(title)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Check", "Result", "Details"})
+	failures := 0
+	for _, check := range checks {
+		err := check.run()
+		if err != nil {
+			failures++
+			t.AppendRow(table.Row{check.name, "FAIL", err.Error()})
+		} else {
+			t.AppendRow(table.Row{check.name, "PASS", ""})
+		}
+	}
+	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
+	t.Render()
+	return failures
+}
+
+func expectFailure(data []byte, err error) error {
+	if err == nil {
+		return fmt.Errorf("request succeeded and returned %d bytes", len(data))
+	}
+	log.Debug().Err(err).Msg("Request failed as expected")
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mxcd/tester-toolbox/cmd/s3-tester"
+
+// tracer creates the spans of S3 operations with the global tracer provider.
+// It is a no-op unless tracing is set up with --trace-exporter.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+const (
+	attributeObjectSize = attribute.Key("s3_tester.object_size")
+	attributeStatus     = attribute.Key("s3_tester.status")
+	attributeAttempts   = attribute.Key("s3_tester.attempts")
+	attributeThrottled  = attribute.Key("s3_tester.throttled")
+)
+
+func tracingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "trace-exporter",
+			Usage: "Export a span per S3 operation: otlp-grpc, otlp-http or file:<path>",
+		},
+		&cli.StringFlag{
+			Name:  "trace-endpoint",
+			Usage: "OTLP collector endpoint, e.g. localhost:4317. Defaults to $OTEL_EXPORTER_OTLP_ENDPOINT",
+		},
+		&cli.BoolFlag{
+			Name:  "trace-insecure",
+			Usage: "Connect to the OTLP collector without TLS",
+		},
+		&cli.Float64Flag{
+			Name:  "trace-sample-rate",
+			Usage: "Fraction of operations to trace",
+			Value: 1,
+		},
+	}
+}
+
+// newSpanExporter creates the exporter described by --trace-exporter. The
+// returned close function releases what the exporter itself does not.
+func newSpanExporter(ctx context.Context, exporter string, endpoint string, insecure bool) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+	switch {
+	case exporter == "otlp-grpc":
+		options := []otlptracegrpc.Option{}
+		if endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(endpoint))
+		}
+		if insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		spanExporter, err := otlptracegrpc.New(ctx, options...)
+		return spanExporter, noClose, err
+	case exporter == "otlp-http":
+		options := []otlptracehttp.Option{}
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		spanExporter, err := otlptracehttp.New(ctx, options...)
+		return spanExporter, noClose, err
+	case strings.HasPrefix(exporter, "file:"):
+		file, err := os.Create(strings.TrimPrefix(exporter, "file:"))
+		if err != nil {
+			return nil, nil, err
+		}
+		spanExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return spanExporter, file.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter '%s', use otlp-grpc, otlp-http or file:<path>", exporter)
+	}
+}
+
+// setupTracing installs a tracer provider for the exporter configured with
+// --trace-exporter and the W3C trace context propagator, so that the
+// requests carry a traceparent header the backend can pick up. The returned
+// function flushes the remaining spans.
+func setupTracing(c *cli.Context) (func(ctx context.Context) error, error) {
+	exporter := c.String("trace-exporter")
+	if exporter == "" {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+	sampleRate := c.Float64("trace-sample-rate")
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("trace sample rate must be between 0 and 1, got %f", sampleRate)
+	}
+
+	spanExporter, closeExporter, err := newSpanExporter(c.Context, exporter, c.String("trace-endpoint"), c.Bool("trace-insecure"))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithSampler(sdktrace.TraceIDRatioBased(sampleRate)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("s3-tester"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	log.Info().Msgf("Tracing %.0f%% of the operations with the %s exporter", sampleRate*100, exporter)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeExporter())
+	}, nil
+}
+
+// startOperationSpan starts the span of an S3 operation on an object.
+func startOperationSpan(ctx context.Context, method string, bucket string, key string, size int64) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "S3 "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.RPCSystemKey.String("aws-api"),
+			semconv.RPCService("S3"),
+			semconv.RPCMethod(method),
+			semconv.AWSS3Bucket(bucket),
+			semconv.AWSS3Key(key),
+			attributeObjectSize.Int64(size),
+		),
+	)
+}
+
+func endOperationSpan(span trace.Span, tracker *attemptTracker, err error) {
+	span.SetAttributes(
+		attributeStatus.String(metricsStatus(err)),
+		attributeAttempts.Int(tracker.attempts()),
+		attributeThrottled.Int(tracker.throttledResponses()),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingTransport records a span for every HTTP request of a traced S3
+// operation with the timings of the connection phases and propagates the
+// trace context to the backend.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !trace.SpanFromContext(req.Context()).IsRecording() {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	phases := &connectionPhases{start: time.Now()}
+	ctx = httptrace.WithClientTrace(ctx, phases.clientTrace())
+	// the header is not signed, so adding it keeps the signature valid
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.base.RoundTrip(req)
+	span.SetAttributes(phases.attributes()...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return res, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= 400 {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	return res, err
+}
+
+// connectionPhases collects the timings of an HTTP request as offsets to its
+// start. Phases of a reused connection are not recorded.
+type connectionPhases struct {
+	mutex      sync.Mutex
+	start      time.Time
+	reused     bool
+	dnsStart   time.Time
+	dns        time.Duration
+	connStart  time.Time
+	connect    time.Duration
+	tlsStart   time.Time
+	tls        time.Duration
+	wrote      time.Duration
+	firstByte  time.Duration
+	gotConnect time.Duration
+}
+
+func (p *connectionPhases) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { p.set(func() { p.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { p.set(func() { p.dns = time.Since(p.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			p.set(func() { p.connStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			p.set(func() { p.connect = time.Since(p.connStart) })
+		},
+		TLSHandshakeStart: func() { p.set(func() { p.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.set(func() { p.tls = time.Since(p.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			p.set(func() {
+				p.reused = info.Reused
+				p.gotConnect = time.Since(p.start)
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { p.set(func() { p.wrote = time.Since(p.start) }) },
+		GotFirstResponseByte: func() {
+			p.set(func() { p.firstByte = time.Since(p.start) })
+		},
+	}
+}
+
+func (p *connectionPhases) set(update func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	update()
+}
+
+func (p *connectionPhases) attributes() []attribute.KeyValue {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	milliseconds := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	attributes := []attribute.KeyValue{
+		attribute.Bool("s3_tester.connection.reused", p.reused),
+		attribute.Float64("s3_tester.connection.get_ms", milliseconds(p.gotConnect)),
+		attribute.Float64("s3_tester.request.written_ms", milliseconds(p.wrote)),
+		attribute.Float64("s3_tester.response.first_byte_ms", milliseconds(p.firstByte)),
+	}
+	if !p.reused {
+		attributes = append(attributes,
+			attribute.Float64("s3_tester.connection.dns_ms", milliseconds(p.dns)),
+			attribute.Float64("s3_tester.connection.connect_ms", milliseconds(p.connect)),
+			attribute.Float64("s3_tester.connection.tls_ms", milliseconds(p.tls)),
+		)
+	}
+	return attributes
+}
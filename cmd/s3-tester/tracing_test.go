@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mxcd/tester-toolbox/internal/s3mock_server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useSpanRecorder records the spans of a test with the global tracer provider.
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestPerformanceTracing(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	mock := s3mock_server.NewServer(s3mock_server.Options{AccessKey: mockAccessKey, SecretKey: mockSecretKey})
+	mock.CreateBucket(mockBucket)
+	mutex := sync.Mutex{}
+	traceparents := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		traceparents[r.Header.Get("traceparent")] = true
+		mutex.Unlock()
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	config := performanceConfig{VUs: 1, Duration: 1, FileSize: "4KiB", Payload: "random"}
+	results := runMockPerformance(t, newTestTarget(t, server.URL), config)
+
+	operations := make(map[string]int)
+	requests := 0
+	for _, span := range recorder.Ended() {
+		if strings.HasPrefix(span.Name(), "HTTP ") {
+			requests++
+			if !traceparents["00-"+span.SpanContext().TraceID().String()+"-"+span.SpanContext().SpanID().String()+"-01"] {
+				t.Errorf("Expected the backend to receive the trace context of %s", span.Name())
+			}
+			if span.Parent().TraceID() != span.SpanContext().TraceID() || !span.Parent().IsValid() {
+				t.Errorf("Expected %s to be a child of its operation", span.Name())
+			}
+			if _, ok := spanAttribute(span, "s3_tester.response.first_byte_ms"); !ok {
+				t.Errorf("Expected connection phase timings on %s", span.Name())
+			}
+			continue
+		}
+		operations[span.Name()]++
+		key, _ := spanAttribute(span, "aws.s3.key")
+		status, _ := spanAttribute(span, attributeStatus)
+		attempts, _ := spanAttribute(span, attributeAttempts)
+		if key.AsString() == "" || status.AsString() != "success" || attempts.AsInt64() != 1 {
+			t.Errorf("Expected key, status and attempts on %s but got %v", span.Name(), span.Attributes())
+		}
+	}
+
+	if operations["S3 PutObject"] != results.Upload.Operations || operations["S3 GetObject"] != results.Download.Operations || operations["S3 DeleteObject"] != results.Delete.Operations {
+		t.Errorf("Expected a span per operation but got %v for %d uploads", operations, results.Upload.Operations)
+	}
+	if requests < results.Upload.Operations*3 {
+		t.Errorf("Expected a span per request but got %d", requests)
+	}
+}
+
+func TestFileSpanExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	exporter, closeExporter, err := newSpanExporter(context.Background(), "file:"+path, "", false)
+	if err != nil {
+		t.Fatalf("Failed to create file exporter: %s", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "S3 PutObject")
+	span.End()
+	provider.Shutdown(context.Background())
+	closeExporter()
+
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), `"Name":"S3 PutObject"`) {
+		t.Errorf("Expected the span in the trace file but got %s", data)
+	}
+
+	_, _, err = newSpanExporter(context.Background(), "zipkin", "", false)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/minio/minio-go/v7"
+	"github.com/mxcd/tester-toolbox/internal/payload"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+type versioningResults struct {
+	Overwrite    operationResults
+	ListVersions operationResults
+	ReadVersion  operationResults
+	DeleteMarker operationResults
+	Failures     []string
+}
+
+func (r *versioningResults) operations() []*operationResults {
+	return []*operationResults{&r.Overwrite, &r.ListVersions, &r.ReadVersion, &r.DeleteMarker}
+}
+
+func (r *versioningResults) fail(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Error().Msg(message)
+	r.Failures = append(r.Failures, message)
+}
+
+// versioning overwrites keys in a versioned bucket, reads back every
+// version, deletes the keys with a delete marker and compares the timings
+// with the same workload on an unversioned baseline bucket.
+func versioning(c *cli.Context) error {
+	client := getS3Client(c)
+	S3_BUCKET := c.String("bucket")
+	baselineBucket := c.String("baseline-bucket")
+
+	keys := c.Int("keys")
+	overwrites := c.Int("overwrites")
+	if keys < 1 || overwrites < 2 {
+		log.Fatal().Msg("Please specify at least 1 key and 2 overwrites")
+	}
+	fileSize, err := util.GetByteSizeFromString(c.String("filesize"))
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to parse file size: '%s'", c.String("filesize"))
+	}
+
+	versioningConfig, err := client.GetBucketVersioning(context.Background(), S3_BUCKET)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("Failed to get versioning configuration of bucket '%s'", S3_BUCKET)
+	}
+	if !versioningConfig.Enabled() {
+		log.Fatal().Msgf("Versioning is not enabled on bucket '%s'", S3_BUCKET)
+	}
+
+	log.Info().Msgf("Running versioning workload on '%s' with %d keys and %d overwrites of %s", S3_BUCKET, keys, overwrites, util.GetStringFromByteSize(fileSize))
+	versioned := runVersioningWorkload(client, S3_BUCKET, true, keys, overwrites, fileSize)
+
+	var baseline *versioningResults
+	if baselineBucket != "" {
+		log.Info().Msgf("Running baseline workload on unversioned bucket '%s'", baselineBucket)
+		baseline = runVersioningWorkload(client, baselineBucket, false, keys, overwrites, fileSize)
+	}
+
+	operations := []string{"Overwrite", "List Versions", "Read Version", "Delete Marker"}
+	header := table.Row{"Operation", "Count", "P50 [ms]", "P90 [ms]", "Mean [ms]"}
+	if baseline != nil {
+		header = append(header, "Baseline P50 [ms]", "Baseline Mean [ms]", "Overhead [%]")
+	}
+
+	t := table.NewWriter()
+	t.SetTitle(fmt.Sprintf("S3 Versioning | %d keys | %d overwrites | %s file size", keys, overwrites, util.GetStringFromByteSize(fileSize)))
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(header)
+	for i, operation := range operations {
+		results := versioned.operations()[i]
+		row := table.Row{
+			operation,
+			results.Times.Count,
+			fmt.Sprintf("%.1f", results.Times.Percentile(50)),
+			fmt.Sprintf("%.1f", results.Times.Percentile(90)),
+			fmt.Sprintf("%.1f", results.Times.Mean()),
+		}
+		if baseline != nil {
+			baselineResults := baseline.operations()[i]
+			row = append(row,
+				fmt.Sprintf("%.1f", baselineResults.Times.Percentile(50)),
+				fmt.Sprintf("%.1f", baselineResults.Times.Mean()),
+				fmt.Sprintf("%+.1f", relativeChange(baselineResults.Times.Mean(), results.Times.Mean())),
+			)
+		}
+		t.AppendRow(row)
+	}
+	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
+	t.Render()
+
+	failures := versioned.Failures
+	if baseline != nil {
+		failures = append(failures, baseline.Failures...)
+	}
+	if len(failures) > 0 {
+		return cli.Exit(fmt.Sprintf("%d versioning checks failed", len(failures)), 1)
+	}
+	log.Info().Msg("All versioning checks passed")
+	return nil
+}
+
+func runVersioningWorkload(client *minio.Client, bucket string, versioned bool, keys int, overwrites int, fileSize int64) *versioningResults {
+	results := &versioningResults{}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for k := 0; k < keys; k++ {
+		id := uuid.New().String()
+		versionSeeds := make(map[string]uint64)
+		var latestSeed uint64
+
+		for i := 0; i < overwrites; i++ {
+			seed := random.Uint64()
+			ctx, tracker := withAttemptTracker(context.Background())
+			startTime := time.Now()
+			info, err := client.PutObject(ctx, bucket, id, payload.NewReader(payload.ModeRandom, seed, fileSize), fileSize, minio.PutObjectOptions{ContentType: "application/octet-stream"})
+			results.Overwrite.record(time.Since(startTime), fileSize, tracker, err)
+			if err != nil {
+				results.fail("Failed to overwrite object '%s' in '%s': %s", id, bucket, err)
+				continue
+			}
+			versionSeeds[info.VersionID] = seed
+			latestSeed = seed
+		}
+
+		ctx, tracker := withAttemptTracker(context.Background())
+		startTime := time.Now()
+		versions := make([]minio.ObjectInfo, 0)
+		var listErr error
+		for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: id, WithVersions: versioned}) {
+			if object.Err != nil {
+				listErr = object.Err
+				break
+			}
+			versions = append(versions, object)
+		}
+		results.ListVersions.record(time.Since(startTime), 0, tracker, listErr)
+		if listErr != nil {
+			results.fail("Failed to list versions of '%s' in '%s': %s", id, bucket, listErr)
+		}
+
+		expectedVersions := 1
+		if versioned {
+			expectedVersions = len(versionSeeds)
+		}
+		if len(versions) != expectedVersions {
+			results.fail("Expected %d versions of '%s' in '%s' but listed %d", expectedVersions, id, bucket, len(versions))
+		}
+
+		for _, version := range versions {
+			seed, ok := versionSeeds[version.VersionID]
+			if !versioned {
+				seed, ok = latestSeed, true
+			}
+			if !ok {
+				results.fail("Listed unknown version '%s' of '%s'", version.VersionID, id)
+				continue
+			}
+			ctx, tracker := withAttemptTracker(context.Background())
+			startTime := time.Now()
+			err := readVersion(ctx, client, bucket, id, version.VersionID, seed, fileSize)
+			results.ReadVersion.record(time.Since(startTime), fileSize, tracker, err)
+			if err != nil {
+				results.fail("Failed to read version '%s' of '%s': %s", version.VersionID, id, err)
+			}
+		}
+
+		ctx, tracker = withAttemptTracker(context.Background())
+		startTime = time.Now()
+		err := client.RemoveObject(ctx, bucket, id, minio.RemoveObjectOptions{})
+		results.DeleteMarker.record(time.Since(startTime), 0, tracker, err)
+		if err != nil {
+			results.fail("Failed to delete '%s' in '%s': %s", id, bucket, err)
+		}
+
+		if versioned {
+			_, err = client.StatObject(context.Background(), bucket, id, minio.StatObjectOptions{})
+			if err == nil {
+				results.fail("Object '%s' is still readable after its delete marker was set", id)
+			}
+			deleteMarkers := 0
+			for object := range client.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{Prefix: id, WithVersions: true}) {
+				if object.Err != nil {
+					break
+				}
+				if object.IsDeleteMarker {
+					deleteMarkers++
+				}
+				err := client.RemoveObject(context.Background(), bucket, id, minio.RemoveObjectOptions{VersionID: object.VersionID})
+				if err != nil {
+					log.Warn().Err(err).Msgf("Failed to remove version '%s' of '%s'", object.VersionID, id)
+				}
+			}
+			if deleteMarkers != 1 {
+				results.fail("Expected 1 delete marker for '%s' but found %d", id, deleteMarkers)
+			}
+		}
+	}
+	return results
+}
+
+func readVersion(ctx context.Context, client *minio.Client, bucket string, id string, versionID string, seed uint64, fileSize int64) error {
+	object, err := client.GetObject(ctx, bucket, id, minio.GetObjectOptions{VersionID: versionID})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	verifier := payload.NewVerifier(payload.ModeRandom, seed, fileSize)
+	_, err = io.Copy(verifier, object)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify()
+}
+
+// objectLock verifies that retention and legal holds prevent the deletion
+// of object versions in a bucket with object lock enabled.
+func objectLock(c *cli.Context) error {
+	client := getS3Client(c)
+	S3_BUCKET := c.String("bucket")
+
+	mode := minio.RetentionMode(c.String("mode"))
+	if !mode.IsValid() {
+		log.Fatal().Msgf("Retention mode '%s' not recognized, use GOVERNANCE or COMPLIANCE", mode)
+	}
+	retention := c.Duration("retention")
+	if retention <= 0 {
+		log.Fatal().Msg("Please specify a positive retention")
+	}
+
+	objectLockStatus, _, _, _, err := client.GetObjectLockConfig(context.Background(), S3_BUCKET)
+	if err != nil || objectLockStatus != "Enabled" {
+		log.Fatal().Err(err).Msgf("Object lock is not enabled on bucket '%s'", S3_BUCKET)
+	}
+
+	fileSize := int64(1024)
+	put := func(opts minio.PutObjectOptions) (string, string, error) {
+		id := uuid.New().String()
+		opts.ContentType = "application/octet-stream"
+		info, err := client.PutObject(context.Background(), S3_BUCKET, id, payload.NewReader(payload.ModeRandom, rand.Uint64(), fileSize), fileSize, opts)
+		return id, info.VersionID, err
+	}
+	remove := func(id string, versionID string, bypass bool) error {
+		return client.RemoveObject(context.Background(), S3_BUCKET, id, minio.RemoveObjectOptions{VersionID: versionID, GovernanceBypass: bypass})
+	}
+
+	retainUntil := time.Now().Add(retention).UTC()
+	retainedID, retainedVersion, err := put(minio.PutObjectOptions{Mode: mode, RetainUntilDate: retainUntil})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to upload object with retention")
+	}
+	heldID, heldVersion, err := put(minio.PutObjectOptions{LegalHold: minio.LegalHoldEnabled})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to upload object with legal hold")
+	}
+
+	checks := []conformanceCheck{
+		{"Retained version cannot be deleted", func() error {
+			return expectFailure(nil, remove(retainedID, retainedVersion, false))
+		}},
+		{"Retention cannot be shortened", func() error {
+			shortened := time.Now().Add(retention / 2).UTC()
+			return expectFailure(nil, client.PutObjectRetention(context.Background(), S3_BUCKET, retainedID, minio.PutObjectRetentionOptions{Mode: &mode, RetainUntilDate: &shortened, VersionID: retainedVersion}))
+		}},
+		{"Delete without version id only sets a delete marker", func() error {
+			err := remove(retainedID, "", false)
+			if err != nil {
+				return err
+			}
+			_, err = client.StatObject(context.Background(), S3_BUCKET, retainedID, minio.StatObjectOptions{VersionID: retainedVersion})
+			return err
+		}},
+		{"Version under legal hold cannot be deleted", func() error {
+			return expectFailure(nil, remove(heldID, heldVersion, true))
+		}},
+		{"Version can be deleted after legal hold is released", func() error {
+			status := minio.LegalHoldDisabled
+			err := client.PutObjectLegalHold(context.Background(), S3_BUCKET, heldID, minio.PutObjectLegalHoldOptions{VersionID: heldVersion, Status: &status})
+			if err != nil {
+				return err
+			}
+			return remove(heldID, heldVersion, false)
+		}},
+	}
+	if mode == minio.Compliance {
+		checks = append(checks, conformanceCheck{"Compliance retention cannot be bypassed", func() error {
+			return expectFailure(nil, remove(retainedID, retainedVersion, true))
+		}})
+	}
+
+	failures := runConformanceChecks(fmt.Sprintf("S3 Object Lock | %s | %s retention", mode, retention), checks)
+
+	for object := range client.ListObjects(context.Background(), S3_BUCKET, minio.ListObjectsOptions{Prefix: retainedID, WithVersions: true}) {
+		if object.Err != nil {
+			continue
+		}
+		if object.IsDeleteMarker || mode == minio.Governance {
+			err = remove(retainedID, object.VersionID, !object.IsDeleteMarker)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Failed to remove retained object '%s'", retainedID)
+			}
+		} else {
+			log.Warn().Msgf("Object '%s' version '%s' is retained until %s and cannot be removed before", retainedID, object.VersionID, retainUntil.Format(time.RFC3339))
+		}
+	}
+
+	if failures > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d object lock checks failed", failures, len(checks)), 1)
+	}
+	return nil
+}
+
+func relativeChange(baseline float64, current float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (current - baseline) / baseline * 100
+}
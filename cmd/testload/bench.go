@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mxcd/tester-toolbox/internal/testload_client"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func benchFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "connections",
+			Aliases: []string{"c"},
+			Usage:   "Number of parallel connections",
+			Value:   4,
+		},
+		&cli.DurationFlag{
+			Name:    "duration",
+			Aliases: []string{"d"},
+			Usage:   "Duration of the benchmark, e.g. 30s. Defaults to 10s unless --total is given",
+		},
+		&cli.StringFlag{
+			Name:  "total",
+			Usage: "Stop after downloading this many bytes in total, e.g. 10GiB",
+		},
+		&cli.StringFlag{
+			Name:  "protocol",
+			Usage: fmt.Sprintf("HTTP protocol, one of %s. http2 uses h2c for http URLs", strings.Join(testload_client.Protocols, ", ")),
+			Value: testload_client.ProtocolAuto,
+		},
+		&cli.BoolFlag{
+			Name:    "insecure",
+			Aliases: []string{"k"},
+			Usage:   "Skip the verification of TLS certificates, e.g. for self-signed ones",
+		},
+	}
+}
+
+func getBenchOptions(c *cli.Context) testload_client.Options {
+	options := testload_client.Options{
+		URL:         c.Args().First(),
+		Connections: c.Int("connections"),
+		Duration:    c.Duration("duration"),
+		Protocol:    c.String("protocol"),
+		Insecure:    c.Bool("insecure"),
+	}
+	if options.URL == "" {
+		log.Fatal().Msg("Please specify the URL to download, e.g. http://localhost:8080/load/100MiB")
+	}
+	if total := c.String("total"); total != "" {
+		size, err := util.GetByteSizeFromString(total)
+		if err != nil {
+			log.Fatal().Err(err).Msgf("Invalid total size '%s'", total)
+		}
+		options.TotalSize = size
+	}
+	if !c.IsSet("duration") && options.TotalSize == 0 {
+		options.Duration = 10 * time.Second
+	}
+	if err := options.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid benchmark configuration")
+	}
+	return options
+}
+
+func bench(c *cli.Context) error {
+	options := getBenchOptions(c)
+	limits := []string{}
+	if options.Duration > 0 {
+		limits = append(limits, options.Duration.String())
+	}
+	if options.TotalSize > 0 {
+		limits = append(limits, util.GetStringFromByteSize(options.TotalSize))
+	}
+	log.Info().Msgf("Downloading %s with %d connections for %s", options.URL, options.Connections, strings.Join(limits, " or until "))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results, err := testload_client.Bench(ctx, options)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	renderBenchResults(results, fmt.Sprintf("%s | %d connections | %s", options.Protocol, options.Connections, strings.Join(limits, " | ")))
+	return nil
+}
+
+func renderBenchResults(results *testload_client.Results, title string) {
+	renderTable(fmt.Sprintf("Testload Bench | %s", title),
+		table.Row{"Elapsed", "Protocol", "Downloads", "Errors", "Bytes", "Throughput [MB/s]", "Throughput [Mbit/s]"},
+		[]table.Row{{
+			results.Elapsed.Round(time.Millisecond),
+			protocols(results.Protocols),
+			results.Downloads,
+			results.ErrorCount(),
+			util.GetStringFromByteSize(results.Bytes),
+			fmt.Sprintf("%.2f", results.Throughput()/1000000),
+			fmt.Sprintf("%.1f", results.Throughput()*8/1000000),
+		}},
+	)
+
+	renderTable(fmt.Sprintf("Testload Bench Percentiles | %s", title),
+		table.Row{"Metric", "min", "max", "P50", "P90", "P99", "Mean", "Std Dev"},
+		[]table.Row{
+			statsRow("TTFB [ms]", results.TTFBs, 1),
+			statsRow("Download Speed [MB/s]", results.DownloadSpeeds, 1000000),
+			statsRow("Connection Speed [MB/s]", results.ConnectionSpeeds, 1000000),
+		},
+	)
+
+	if len(results.Errors) > 0 {
+		errors := make([]string, 0, len(results.Errors))
+		for err := range results.Errors {
+			errors = append(errors, err)
+		}
+		sort.Slice(errors, func(i, j int) bool { return results.Errors[errors[i]] > results.Errors[errors[j]] })
+		rows := make([]table.Row, 0, len(errors))
+		for _, err := range errors {
+			rows = append(rows, table.Row{err, results.Errors[err]})
+		}
+		renderTable("Testload Bench Errors", table.Row{"Error", "Count"}, rows)
+	}
+}
+
+// protocols lists the negotiated protocols, usually just one.
+func protocols(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// statsRow summarizes samples divided by unit.
+func statsRow(metric string, samples []float64, unit float64) table.Row {
+	format := func(value float64) string {
+		return fmt.Sprintf("%.2f", value/unit)
+	}
+	return table.Row{
+		metric,
+		format(util.GetMinFloat64(samples)),
+		format(util.GetMaxFloat64(samples)),
+		format(util.GetPercentileFloat64(samples, 50)),
+		format(util.GetPercentileFloat64(samples, 90)),
+		format(util.GetPercentileFloat64(samples, 99)),
+		format(util.GetMean(samples)),
+		format(util.GetStdDevFloat64(samples)),
+	}
+}
+
+func renderTable(title string, header table.Row, rows []table.Row) {
+	t := table.NewWriter()
+	t.SetTitle(title)
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(header)
+	t.AppendRows(rows)
+	t.SetStyle(table.StyleColoredYellowWhiteOnBlack)
+	t.Render()
+}
@@ -35,12 +35,42 @@ func main() {
 			{
 				Name:        "serve",
 				Usage:       "testload serve",
-				Description: "serve http server with /load/:size endpoint",
+				Description: "serve http server with /load/:size?seed=:seed&payload=:mode endpoint supporting range requests and /upload endpoint as well as /ws and /sse over HTTP/1.1, h2c and optionally TLS with h2 and HTTP/3",
+				Flags:       serveFlags(),
 				Action: func(c *cli.Context) error {
+					startStreamServers(c)
 					testload_server.StartServer()
 					return nil
 				},
 			},
+			{
+				Name:        "bench",
+				Usage:       "testload bench <url>",
+				Description: "downloads from a testload server with parallel connections and reports throughput, TTFB and speed percentiles",
+				Flags:       benchFlags(),
+				Action:      bench,
+			},
+			{
+				Name:        "tcp",
+				Usage:       "testload tcp <host:port>",
+				Description: "streams raw TCP to or from the --tcp server of testload serve and reports goodput and retransmits",
+				Flags:       tcpFlags(),
+				Action:      tcp,
+			},
+			{
+				Name:        "udp",
+				Usage:       "testload udp <host:port>",
+				Description: "sends UDP datagrams at a fixed rate to the --udp server of testload serve and reports loss, jitter and reordering",
+				Flags:       udpFlags(),
+				Action:      udp,
+			},
+			{
+				Name:        "messages",
+				Usage:       "testload messages <url>",
+				Description: "keeps many WebSocket (ws, wss) or server-sent events (http, https) connections open and reports message latency and dropped connections",
+				Flags:       messagesFlags(),
+				Action:      messages,
+			},
 		},
 	}
 	err := app.Run(os.Args)
@@ -50,10 +80,15 @@ func main() {
 }
 
 func initConfig() {
-	err := config.LoadConfig([]config.Value{
+	err := config.LoadConfig(append([]config.Value{
 		config.String("LOG_LEVEL").NotEmpty().Default("info"),
 		config.Int("PORT").Default(8080),
-	})
+		config.Bool("H2C").Default(true),
+		config.Int("TLS_PORT").Default(0),
+		config.String("TLS_CERT").Default(""),
+		config.String("TLS_KEY").Default(""),
+		config.Bool("HTTP3").Default(false),
+	}, util.ServerTimeoutConfig()...))
 	if err != nil {
 		panic(err)
 	}
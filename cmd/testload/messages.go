@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mxcd/tester-toolbox/internal/testload_client"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func messagesFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "connections",
+			Aliases: []string{"c"},
+			Usage:   "Number of concurrent connections",
+			Value:   100,
+		},
+		&cli.DurationFlag{
+			Name:    "duration",
+			Aliases: []string{"d"},
+			Usage:   "Duration to keep the connections open",
+			Value:   30 * time.Second,
+		},
+		&cli.Float64Flag{
+			Name:    "rate",
+			Aliases: []string{"r"},
+			Usage:   "Messages per second each WebSocket connection sends to be echoed, 0 only receives",
+		},
+		&cli.IntFlag{
+			Name:  "size",
+			Usage: "Size of the sent messages in bytes",
+			Value: 64,
+		},
+		&cli.BoolFlag{
+			Name:    "insecure",
+			Aliases: []string{"k"},
+			Usage:   "Skip the verification of TLS certificates, e.g. for self-signed ones",
+		},
+	}
+}
+
+func messages(c *cli.Context) error {
+	options := testload_client.MessageOptions{
+		URL:         c.Args().First(),
+		Connections: c.Int("connections"),
+		Duration:    c.Duration("duration"),
+		Rate:        c.Float64("rate"),
+		Size:        c.Int("size"),
+		Insecure:    c.Bool("insecure"),
+	}
+	if err := options.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid message test configuration, e.g. testload messages ws://localhost:8080/ws?rate=10")
+	}
+	log.Info().Msgf("Opening %d connections to %s for %s", options.Connections, options.URL, options.Duration)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results, err := testload_client.Messages(ctx, options)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	title := fmt.Sprintf("%d connections | %s", options.Connections, options.Duration)
+	renderTable(fmt.Sprintf("Testload Messages | %s", title),
+		table.Row{"Elapsed", "Connected", "Failed", "Dropped", "Messages", "Bytes"},
+		[]table.Row{{
+			results.Elapsed.Round(time.Millisecond),
+			results.Connected,
+			results.ErrorCount(),
+			results.Dropped(),
+			results.Messages,
+			util.GetStringFromByteSize(results.Bytes),
+		}},
+	)
+
+	rows := []table.Row{statsRow("Connect [ms]", results.ConnectTimes, 1)}
+	if len(results.RoundTrips) > 0 {
+		rows = append(rows, statsRow("Round Trip [ms]", results.RoundTrips, 1))
+	}
+	if len(results.Delays) > 0 {
+		rows = append(rows, statsRow("Push Delay [ms]", results.Delays, 1))
+	}
+	if results.Dropped() > 0 {
+		rows = append(rows, statsRow("Dropped After [s]", results.Lifetimes, 1))
+	}
+	renderTable(fmt.Sprintf("Testload Messages Percentiles | %s", title),
+		table.Row{"Metric", "min", "max", "P50", "P90", "P99", "Mean", "Std Dev"},
+		rows,
+	)
+
+	if len(results.Errors) > 0 {
+		errors := make([]string, 0, len(results.Errors))
+		for err := range results.Errors {
+			errors = append(errors, err)
+		}
+		sort.Slice(errors, func(i, j int) bool { return results.Errors[errors[i]] > results.Errors[errors[j]] })
+		rows := make([]table.Row, 0, len(errors))
+		for _, err := range errors {
+			rows = append(rows, table.Row{err, results.Errors[err]})
+		}
+		renderTable("Testload Messages Errors", table.Row{"Error", "Count"}, rows)
+	}
+	return nil
+}
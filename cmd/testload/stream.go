@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mxcd/tester-toolbox/internal/testload_stream"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+func serveFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "tcp",
+			Usage:   "Address of the raw TCP stream server, e.g. :5201",
+			EnvVars: []string{"TCP_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "udp",
+			Usage:   "Address of the raw UDP stream server, e.g. :5202",
+			EnvVars: []string{"UDP_ADDRESS"},
+		},
+	}
+}
+
+// startStreamServers starts the raw TCP and UDP servers that are configured.
+func startStreamServers(c *cli.Context) {
+	servers := []struct {
+		address string
+		serve   func(string) error
+	}{
+		{c.String("tcp"), testload_stream.ListenAndServeTCP},
+		{c.String("udp"), testload_stream.ListenAndServeUDP},
+	}
+	for _, server := range servers {
+		if server.address == "" {
+			continue
+		}
+		go func(address string, serve func(string) error) {
+			err := serve(address)
+			log.Fatal().Err(err).Msgf("Stream server on %s stopped", address)
+		}(server.address, server.serve)
+	}
+}
+
+func tcpFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "streams",
+			Aliases: []string{"P"},
+			Usage:   "Number of parallel TCP connections",
+			Value:   1,
+		},
+		&cli.DurationFlag{
+			Name:    "duration",
+			Aliases: []string{"d"},
+			Usage:   "Duration of the test",
+			Value:   10 * time.Second,
+		},
+		&cli.BoolFlag{
+			Name:    "reverse",
+			Aliases: []string{"R"},
+			Usage:   "The server sends and the client receives",
+		},
+	}
+}
+
+func tcp(c *cli.Context) error {
+	options := testload_stream.TCPOptions{
+		Address:  c.Args().First(),
+		Streams:  c.Int("streams"),
+		Duration: c.Duration("duration"),
+		Reverse:  c.Bool("reverse"),
+	}
+	if err := options.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid TCP test configuration, e.g. testload tcp localhost:5201")
+	}
+	direction := "to"
+	if options.Reverse {
+		direction = "from"
+	}
+	log.Info().Msgf("Streaming %s %s over %d TCP connections for %s", direction, options.Address, options.Streams, options.Duration)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results, err := testload_stream.TCP(ctx, options)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	rows := make([]table.Row, 0, len(results.Streams)+1)
+	for i, stream := range results.Streams {
+		rows = append(rows, tcpRow(fmt.Sprint(i+1), stream.Elapsed, stream.Sent, stream.Received, stream.Throughput(), stream.Retransmits))
+	}
+	var sent int64
+	for _, stream := range results.Streams {
+		sent += stream.Sent
+	}
+	rows = append(rows, tcpRow("Total", results.Elapsed, sent, results.Received(), results.Throughput(), results.Retransmits()))
+	renderTable(fmt.Sprintf("Testload TCP | %s %s | %d streams | %s", direction, options.Address, options.Streams, options.Duration),
+		table.Row{"Stream", "Elapsed", "Sent", "Received", "Goodput [MB/s]", "Goodput [Mbit/s]", "Retransmits"},
+		rows,
+	)
+	return nil
+}
+
+func tcpRow(stream string, elapsed time.Duration, sent int64, received int64, throughput float64, retransmits int64) table.Row {
+	retransmitted := "n/a"
+	if retransmits >= 0 {
+		retransmitted = fmt.Sprint(retransmits)
+	}
+	return table.Row{
+		stream,
+		elapsed.Round(time.Millisecond),
+		util.GetStringFromByteSize(sent),
+		util.GetStringFromByteSize(received),
+		fmt.Sprintf("%.2f", throughput/1000000),
+		fmt.Sprintf("%.1f", throughput*8/1000000),
+		retransmitted,
+	}
+}
+
+func udpFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:    "duration",
+			Aliases: []string{"d"},
+			Usage:   "Duration of the test",
+			Value:   10 * time.Second,
+		},
+		&cli.StringFlag{
+			Name:    "rate",
+			Aliases: []string{"r"},
+			Usage:   "Send rate, e.g. 10MiB/s",
+			Value:   "1MiB/s",
+		},
+		&cli.IntFlag{
+			Name:  "size",
+			Usage: "Size of the datagrams in bytes",
+			Value: 1400,
+		},
+	}
+}
+
+func udp(c *cli.Context) error {
+	rate, err := util.GetRateFromString(c.String("rate"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid rate")
+	}
+	options := testload_stream.UDPOptions{
+		Address:  c.Args().First(),
+		Duration: c.Duration("duration"),
+		Rate:     rate,
+		Size:     c.Int("size"),
+	}
+	if err := options.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid UDP test configuration, e.g. testload udp localhost:5202")
+	}
+	log.Info().Msgf("Sending %d byte datagrams at %s/s to %s for %s", options.Size, util.GetStringFromByteSize(options.Rate), options.Address, options.Duration)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results, err := testload_stream.UDP(ctx, options)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	renderTable(fmt.Sprintf("Testload UDP | %s | %s/s | %d bytes | %s", options.Address, util.GetStringFromByteSize(options.Rate), options.Size, options.Duration),
+		table.Row{"Elapsed", "Sent", "Received", "Lost", "Loss [%]", "Out of Order", "Jitter [ms]", "Throughput [MB/s]", "Throughput [Mbit/s]"},
+		[]table.Row{{
+			results.Elapsed.Round(time.Millisecond),
+			results.SentPackets,
+			results.ReceivedPackets,
+			results.Lost,
+			fmt.Sprintf("%.2f", results.LossPercent()),
+			results.OutOfOrder,
+			fmt.Sprintf("%.3f", float64(results.Jitter)/float64(time.Millisecond)),
+			fmt.Sprintf("%.2f", results.Throughput()/1000000),
+			fmt.Sprintf("%.1f", results.Throughput()*8/1000000),
+		}},
+	)
+	return nil
+}
@@ -67,7 +67,7 @@ func sendSingleMail(c *cli.Context) error {
 }
 
 func initConfig() {
-	err := config.LoadConfig([]config.Value{
+	err := config.LoadConfig(append([]config.Value{
 		config.String("LOG_LEVEL").NotEmpty().Default("info"),
 
 		config.String("SMTP_HOST").NotEmpty().Default("localhost"),
@@ -77,7 +77,7 @@ func initConfig() {
 		config.Bool("SMTP_TLS").Default(true),
 		config.String("FROM_ADDRESS").NotEmpty(),
 		config.Int("PORT").Default(8080),
-	})
+	}, util.ServerTimeoutConfig()...))
 	if err != nil {
 		panic(err)
 	}
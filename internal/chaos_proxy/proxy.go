@@ -0,0 +1,343 @@
+package chaos_proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdlog "log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+)
+
+// Options configures the faults injected by the proxy. The slowdown, reset
+// and truncate rates are the fractions of requests that get the respective
+// fault. A request gets at most one of them, so they must add up to at most 1.
+type Options struct {
+	Upstream *url.URL
+	// Latency is added to every request before it is forwarded.
+	Latency time.Duration
+	// Jitter adds a uniformly distributed random delay between zero and Jitter.
+	Jitter time.Duration
+	// Bandwidth caps request and response bodies to the given bytes per second
+	// per request. Zero means unlimited.
+	Bandwidth int64
+	// SlowDownRate is the fraction of requests answered with 503 SlowDown without forwarding.
+	SlowDownRate float64
+	// ResetRate is the fraction of requests whose connection is reset without forwarding.
+	ResetRate float64
+	// TruncateRate is the fraction of requests that are forwarded but whose
+	// response body is cut off at a random position. Responses without a
+	// body are passed through unchanged.
+	TruncateRate float64
+	// Seed initializes the random source of the injected faults.
+	// Zero uses the current time.
+	Seed int64
+}
+
+func (o *Options) Validate() error {
+	if o.Upstream == nil || o.Upstream.Host == "" {
+		return fmt.Errorf("upstream URL is required")
+	}
+	if o.Latency < 0 || o.Jitter < 0 {
+		return fmt.Errorf("latency and jitter must not be negative")
+	}
+	if o.Bandwidth < 0 {
+		return fmt.Errorf("bandwidth must not be negative")
+	}
+	if o.SlowDownRate < 0 || o.ResetRate < 0 || o.TruncateRate < 0 || o.SlowDownRate+o.ResetRate+o.TruncateRate > 1 {
+		return fmt.Errorf("slowdown, reset and truncate rates must be between 0 and 1 and add up to at most 1")
+	}
+	return nil
+}
+
+// Stats counts the requests seen by the proxy and the faults injected into them.
+type Stats struct {
+	Requests    uint64
+	SlowDowns   uint64
+	Resets      uint64
+	Truncations uint64
+}
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultSlowDown
+	faultReset
+	faultTruncate
+)
+
+// Proxy is a reverse proxy that injects faults between S3 clients and an S3
+// endpoint. It keeps the Host header of the client, so AWS signature version 4
+// stays valid for endpoints that do not route requests by host name.
+type Proxy struct {
+	options Options
+	proxy   *httputil.ReverseProxy
+
+	randomMutex sync.Mutex
+	random      *rand.Rand
+
+	requests    atomic.Uint64
+	slowDowns   atomic.Uint64
+	resets      atomic.Uint64
+	truncations atomic.Uint64
+}
+
+type truncateKey struct{}
+
+// contextWithTruncation marks a request whose response is cut off after the
+// given fraction of its length.
+func contextWithTruncation(ctx context.Context, cut float64) context.Context {
+	return context.WithValue(ctx, truncateKey{}, cut)
+}
+
+func truncationFromContext(ctx context.Context) (float64, bool) {
+	cut, ok := ctx.Value(truncateKey{}).(float64)
+	return cut, ok
+}
+
+func NewProxy(options Options) (*Proxy, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	p := &Proxy{
+		options: options,
+		random:  rand.New(rand.NewSource(seed)),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(options.Upstream)
+			r.Out.Host = r.In.Host
+		},
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Warn().Err(err).Msgf("Failed to forward %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+		// body copy errors are expected for truncated responses
+		ErrorLog: stdlog.New(io.Discard, "", 0),
+	}
+	return p, nil
+}
+
+func (p *Proxy) Stats() Stats {
+	return Stats{
+		Requests:    p.requests.Load(),
+		SlowDowns:   p.slowDowns.Load(),
+		Resets:      p.resets.Load(),
+		Truncations: p.truncations.Load(),
+	}
+}
+
+// inject draws the latency and the fault for a request.
+func (p *Proxy) inject() (time.Duration, fault, float64) {
+	p.randomMutex.Lock()
+	defer p.randomMutex.Unlock()
+
+	delay := p.options.Latency
+	if p.options.Jitter > 0 {
+		delay += time.Duration(p.random.Int63n(int64(p.options.Jitter)))
+	}
+
+	draw := p.random.Float64()
+	cut := p.random.Float64()
+	switch {
+	case draw < p.options.SlowDownRate:
+		return delay, faultSlowDown, cut
+	case draw < p.options.SlowDownRate+p.options.ResetRate:
+		return delay, faultReset, cut
+	case draw < p.options.SlowDownRate+p.options.ResetRate+p.options.TruncateRate:
+		return delay, faultTruncate, cut
+	}
+	return delay, faultNone, cut
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.requests.Add(1)
+	delay, fault, cut := p.inject()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch fault {
+	case faultSlowDown:
+		p.slowDowns.Add(1)
+		log.Debug().Msgf("Injecting SlowDown into %s %s", r.Method, r.URL.Path)
+		writeSlowDown(w, r)
+		return
+	case faultReset:
+		p.resets.Add(1)
+		log.Debug().Msgf("Resetting connection of %s %s", r.Method, r.URL.Path)
+		resetConnection(w)
+		return
+	case faultTruncate:
+		r = r.WithContext(contextWithTruncation(r.Context(), cut))
+	}
+
+	if p.options.Bandwidth > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = newThrottledBody(r.Body, p.options.Bandwidth)
+	}
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) modifyResponse(response *http.Response) error {
+	if cut, ok := truncationFromContext(response.Request.Context()); ok && hasBody(response) {
+		body := &truncatedBody{ReadCloser: response.Body, truncated: func() {
+			p.truncations.Add(1)
+			log.Debug().Msgf("Truncated response of %s %s", response.Request.Method, response.Request.URL.Path)
+		}}
+		if response.ContentLength > 0 {
+			body.remaining = int64(cut * float64(response.ContentLength))
+		} else {
+			// the length is unknown, so cut within the first chunk that arrives
+			body.cut = cut
+			body.unknownLength = true
+		}
+		response.Body = body
+	}
+	if p.options.Bandwidth > 0 {
+		response.Body = newThrottledBody(response.Body, p.options.Bandwidth)
+	}
+	return nil
+}
+
+func writeSlowDown(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if r.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message><Resource>%s</Resource></Error>`, r.URL.Path)
+}
+
+// resetConnection closes the client connection with a TCP reset instead of a
+// regular close, which is what clients see when a load balancer drops them.
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// hasBody reports whether a response can be truncated. Responses to HEAD
+// requests and 1xx, 204 and 304 responses have no body to cut.
+func hasBody(response *http.Response) bool {
+	if response.Request.Method == http.MethodHead || response.ContentLength == 0 {
+		return false
+	}
+	status := response.StatusCode
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+var errTruncated = errors.New("response truncated by chaos proxy")
+
+// truncatedBody fails after remaining bytes, which makes the reverse proxy
+// abort the response with the full Content-Length already announced. If
+// the length is unknown, it keeps the fraction cut of the first chunk read.
+// truncated is called once the body is actually cut.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining     int64
+	cut           float64
+	unknownLength bool
+	truncated     func()
+	done          bool
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.unknownLength {
+		n, err := b.ReadCloser.Read(p)
+		if n == 0 {
+			return n, err
+		}
+		b.unknownLength = false
+		b.remaining = 0
+		return int(b.cut * float64(n)), nil
+	}
+	if b.remaining <= 0 {
+		if !b.done {
+			b.done = true
+			b.truncated()
+		}
+		return 0, errTruncated
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// throttledBody limits reads to bandwidth bytes per second since the first read.
+type throttledBody struct {
+	io.ReadCloser
+	throttle *util.Throttle
+}
+
+func newThrottledBody(body io.ReadCloser, bandwidth int64) *throttledBody {
+	return &throttledBody{ReadCloser: body, throttle: util.NewThrottle(bandwidth)}
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	b.throttle.Start()
+	if chunk := b.throttle.ChunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if wait := b.throttle.Transferred(n); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// StartProxy serves the proxy on the given address until the listener fails.
+func StartProxy(listen string, options Options) error {
+	proxy, err := NewProxy(options)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		last := Stats{}
+		for range time.Tick(10 * time.Second) {
+			stats := proxy.Stats()
+			if stats != last {
+				log.Info().Msgf("%d requests, %d slowdowns, %d resets, %d truncations", stats.Requests, stats.SlowDowns, stats.Resets, stats.Truncations)
+				last = stats
+			}
+		}
+	}()
+
+	log.Info().Msgf("Starting chaos proxy on %s for %s", listen, options.Upstream)
+	return http.ListenAndServe(listen, proxy)
+}
@@ -0,0 +1,190 @@
+package chaos_proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var upstreamBody = bytes.Repeat([]byte("chaos"), 20000)
+
+// newTestProxy starts an upstream that echoes uploads and serves a fixed body
+// for downloads, and a proxy in front of it.
+func newTestProxy(t *testing.T, options Options) (*Proxy, *httptest.Server, *string) {
+	upstreamHost := new(string)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*upstreamHost = r.Host
+		switch r.URL.Path {
+		case "/bucket/unchanged":
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case "/bucket/chunked":
+			// flushing before the body leaves its length unknown
+			w.(http.Flusher).Flush()
+			w.Write([]byte("a chunked body much shorter than 64KiB"))
+			return
+		}
+		body := upstreamBody
+		if r.Method == http.MethodPut {
+			body, _ = io.ReadAll(r.Body)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	options.Upstream, _ = url.Parse(upstream.URL)
+	proxy, err := NewProxy(options)
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %s", err)
+	}
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+	return proxy, server, upstreamHost
+}
+
+func TestForward(t *testing.T) {
+	proxy, server, upstreamHost := newTestProxy(t, Options{})
+	response, err := http.Get(server.URL + "/bucket/object")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !bytes.Equal(body, upstreamBody) {
+		t.Errorf("Expected the upstream body")
+	}
+	if *upstreamHost != strings.TrimPrefix(server.URL, "http://") {
+		t.Errorf("Expected the client host %s upstream to keep signatures valid but got %s", server.URL, *upstreamHost)
+	}
+	if proxy.Stats() != (Stats{Requests: 1}) {
+		t.Errorf("Expected one request without faults but got %+v", proxy.Stats())
+	}
+}
+
+func TestSlowDown(t *testing.T) {
+	proxy, server, _ := newTestProxy(t, Options{SlowDownRate: 1})
+	response, err := http.Get(server.URL + "/bucket/object")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "<Code>SlowDown</Code>") {
+		t.Errorf("Expected 503 SlowDown but got %d: %s", response.StatusCode, body)
+	}
+	if proxy.Stats().SlowDowns != 1 {
+		t.Errorf("Expected one slowdown but got %+v", proxy.Stats())
+	}
+}
+
+func TestReset(t *testing.T) {
+	proxy, server, _ := newTestProxy(t, Options{ResetRate: 1})
+	_, err := http.Get(server.URL + "/bucket/object")
+	if err == nil {
+		t.Errorf("Expected the connection to be reset")
+	}
+	if proxy.Stats().Resets == 0 {
+		t.Errorf("Expected resets but got %+v", proxy.Stats())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	proxy, server, _ := newTestProxy(t, Options{TruncateRate: 1, Seed: 1})
+	response, err := http.Get(server.URL + "/bucket/object")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err == nil {
+		t.Errorf("Expected an error reading the truncated body")
+	}
+	if response.ContentLength != int64(len(upstreamBody)) || len(body) >= len(upstreamBody) {
+		t.Errorf("Expected %d announced bytes and fewer received but got %d of %d", len(upstreamBody), len(body), response.ContentLength)
+	}
+	if proxy.Stats().Truncations != 1 {
+		t.Errorf("Expected one truncation but got %+v", proxy.Stats())
+	}
+
+	response, err = http.Get(server.URL + "/bucket/chunked")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	if err == nil || response.ContentLength != -1 || len(body) >= len("a chunked body much shorter than 64KiB") {
+		t.Errorf("Expected the chunked body to be cut but got %d bytes (%v)", len(body), err)
+	}
+	if proxy.Stats().Truncations != 2 {
+		t.Errorf("Expected the chunked body to count as truncation but got %+v", proxy.Stats())
+	}
+
+	// responses without a body can not be cut and are not counted
+	for _, request := range []struct{ method, path string }{{http.MethodHead, "/bucket/object"}, {http.MethodGet, "/bucket/unchanged"}} {
+		r, _ := http.NewRequest(request.method, server.URL+request.path, nil)
+		response, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("%s %s failed: %s", request.method, request.path, err)
+		}
+		response.Body.Close()
+	}
+	if proxy.Stats().Truncations != 2 {
+		t.Errorf("Expected no truncations of HEAD and 304 responses but got %+v", proxy.Stats())
+	}
+}
+
+func TestLatencyAndBandwidth(t *testing.T) {
+	_, server, _ := newTestProxy(t, Options{Latency: 50 * time.Millisecond, Bandwidth: 400 * 1024})
+	start := time.Now()
+	response, err := http.Post(server.URL+"/bucket/object", "application/octet-stream", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms latency but got %s", elapsed)
+	}
+
+	// 100KB up and down at 400KiB/s take at least 2 * 0.24s
+	start = time.Now()
+	request, _ := http.NewRequest(http.MethodPut, server.URL+"/bucket/object", bytes.NewReader(upstreamBody))
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !bytes.Equal(body, upstreamBody) {
+		t.Errorf("Expected the upload to be echoed")
+	}
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Errorf("Expected the bandwidth cap to slow down the transfer but it took %s", elapsed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	upstream, _ := url.Parse("http://localhost:9000")
+	invalid := []Options{
+		{},
+		{Upstream: upstream, Latency: -time.Second},
+		{Upstream: upstream, Bandwidth: -1},
+		{Upstream: upstream, SlowDownRate: 0.5, ResetRate: 0.3, TruncateRate: 0.3},
+		{Upstream: upstream, ResetRate: -0.1},
+	}
+	for _, options := range invalid {
+		if options.Validate() == nil {
+			t.Errorf("Expected options %+v to be invalid", options)
+		}
+	}
+	valid := Options{Upstream: upstream, SlowDownRate: 0.5, ResetRate: 0.25, TruncateRate: 0.25}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected options to be valid but got %s", err)
+	}
+}
@@ -0,0 +1,234 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Mode selects the kind of data a payload consists of.
+type Mode string
+
+const (
+	// ModeRandom generates incompressible pseudo-random data.
+	ModeRandom Mode = "random"
+	// ModeCompressible generates data built from a small set of tokens that compresses well.
+	ModeCompressible Mode = "compressible"
+	// ModeZero generates zero bytes only.
+	ModeZero Mode = "zero"
+	// ModeBlock repeats a precomputed pseudo-random block, which is as fast
+	// as copying memory. It only looks random within the block size, so
+	// compressors with a large window and deduplication can detect it.
+	ModeBlock Mode = "block"
+)
+
+func ParseMode(modeStr string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(modeStr)); mode {
+	case ModeRandom, ModeCompressible, ModeZero, ModeBlock:
+		return mode, nil
+	case "":
+		return ModeRandom, nil
+	default:
+		return "", fmt.Errorf("payload mode '%s' not recognized", modeStr)
+	}
+}
+
+// compressibleTokens holds the building blocks of compressible payloads. Each
+// 8 byte word picks one of its 16 words, which leaves 4 bits of entropy per word.
+const compressibleTokens = "the quick brown fox jumps over the lazy dog. lorem ipsum dolor sit amet, consectetur adipiscing elit sed do eiusmod tempor inci\n"
+
+// Reader is a deterministic stream of size bytes derived from a seed. Every
+// 8 byte word is computed from the seed and its position alone, so the
+// reader can seek and read at arbitrary offsets without buffering the
+// payload, and the same content can be regenerated for verification.
+type Reader struct {
+	mode   Mode
+	seed   uint64
+	size   int64
+	offset int64
+}
+
+func NewReader(mode Mode, seed uint64, size int64) *Reader {
+	return &Reader{mode: mode, seed: seed, size: size}
+}
+
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("payload: negative offset")
+	}
+	if offset >= r.size {
+		return 0, io.EOF
+	}
+	var err error
+	if remaining := r.size - offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+		err = io.EOF
+	}
+	r.fill(p, offset)
+	return len(p), err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("payload: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("payload: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// fill writes the payload bytes starting at offset into p.
+func (r *Reader) fill(p []byte, offset int64) {
+	switch r.mode {
+	case ModeZero:
+		clear(p)
+		return
+	case ModeBlock:
+		r.fillBlock(p, offset)
+		return
+	}
+
+	var word [8]byte
+	index := uint64(offset / 8)
+
+	// leading bytes of a partially requested word
+	if skip := int(offset % 8); skip != 0 {
+		r.word(word[:], index)
+		n := copy(p, word[skip:])
+		p = p[n:]
+		index++
+	}
+
+	for len(p) >= 8 {
+		r.word(p[:8], index)
+		p = p[8:]
+		index++
+	}
+
+	if len(p) > 0 {
+		r.word(word[:], index)
+		copy(p, word[:])
+	}
+}
+
+// blockSize is larger than the window of gzip and the buffers of the
+// network stack, so the repetition does not help either of them.
+const blockSize = 1 << 20
+
+// randomBlock is shared by all block payloads. The seed only selects where
+// in the block a payload starts.
+var randomBlock = sync.OnceValue(func() []byte {
+	block := make([]byte, blockSize)
+	random := &Reader{mode: ModeRandom}
+	for i := 0; i < blockSize; i += 8 {
+		random.word(block[i:i+8], uint64(i/8))
+	}
+	return block
+})
+
+func (r *Reader) fillBlock(p []byte, offset int64) {
+	block := randomBlock()
+	position := (splitmix64(r.seed) + uint64(offset)) % blockSize
+	for len(p) > 0 {
+		n := copy(p, block[position:])
+		p = p[n:]
+		position = 0
+	}
+}
+
+func (r *Reader) word(dst []byte, index uint64) {
+	value := splitmix64(r.seed + index*0x9e3779b97f4a7c15)
+	if r.mode == ModeCompressible {
+		token := (value & 0xf) * 8
+		copy(dst, compressibleTokens[token:token+8])
+		return
+	}
+	binary.LittleEndian.PutUint64(dst, value)
+}
+
+// splitmix64 is the finalizer of the SplitMix64 generator. It is cheap and
+// mixes well enough to make consecutive indices look unrelated.
+func splitmix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Verifier is an io.Writer that compares everything written to it with the
+// payload it was created for.
+type Verifier struct {
+	expected *Reader
+	buffer   []byte
+	written  int64
+	err      error
+}
+
+func NewVerifier(mode Mode, seed uint64, size int64) *Verifier {
+	return &Verifier{expected: NewReader(mode, seed, size), buffer: make([]byte, 32*1024)}
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	total := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > len(v.buffer) {
+			chunk = chunk[:len(v.buffer)]
+		}
+		n, _ := v.expected.ReadAt(v.buffer[:len(chunk)], v.written)
+		if !bytes.Equal(chunk[:n], v.buffer[:n]) {
+			for i := 0; i < n; i++ {
+				if chunk[i] != v.buffer[i] {
+					v.err = fmt.Errorf("payload mismatch at byte %d", v.written+int64(i))
+					break
+				}
+			}
+			return 0, v.err
+		}
+		if n < len(chunk) {
+			v.err = fmt.Errorf("payload longer than expected %d bytes", v.expected.size)
+			return 0, v.err
+		}
+		v.written += int64(n)
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Verify reports whether the complete payload has been written without mismatches.
+func (v *Verifier) Verify() error {
+	if v.err != nil {
+		return v.err
+	}
+	if v.written != v.expected.size {
+		return fmt.Errorf("payload truncated: got %d of %d bytes", v.written, v.expected.size)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestReaderIsDeterministic(t *testing.T) {
+	for _, mode := range []Mode{ModeRandom, ModeCompressible, ModeZero, ModeBlock} {
+		first, err := io.ReadAll(NewReader(mode, 42, 100003))
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s payload: %s", mode, err)
+		}
+		second, _ := io.ReadAll(NewReader(mode, 42, 100003))
+		if len(first) != 100003 {
+			t.Errorf("Expected %d bytes of %s payload but got %d", 100003, mode, len(first))
+		}
+		if !bytes.Equal(first, second) {
+			t.Errorf("Expected %s payloads with the same seed to be equal", mode)
+		}
+	}
+
+	first, _ := io.ReadAll(NewReader(ModeRandom, 1, 1024))
+	second, _ := io.ReadAll(NewReader(ModeRandom, 2, 1024))
+	if bytes.Equal(first, second) {
+		t.Errorf("Expected random payloads with different seeds to differ")
+	}
+}
+
+func TestReaderReadAt(t *testing.T) {
+	reader := NewReader(ModeRandom, 7, 1000)
+	full, _ := io.ReadAll(reader)
+
+	tests := []struct {
+		offset int64
+		length int
+	}{
+		{0, 1},
+		{3, 5},
+		{5, 19},
+		{8, 8},
+		{990, 10},
+	}
+	for _, test := range tests {
+		p := make([]byte, test.length)
+		n, err := reader.ReadAt(p, test.offset)
+		if n != test.length || (err != nil && err != io.EOF) {
+			t.Errorf("Expected %d bytes at offset %d but got %d (%v)", test.length, test.offset, n, err)
+		}
+		if !bytes.Equal(p, full[test.offset:test.offset+int64(test.length)]) {
+			t.Errorf("Expected bytes at offset %d to match the sequential read", test.offset)
+		}
+	}
+
+	reader.Seek(500, io.SeekStart)
+	rest, _ := io.ReadAll(reader)
+	if !bytes.Equal(rest, full[500:]) {
+		t.Errorf("Expected read after seek to match the sequential read")
+	}
+}
+
+func TestBlockReader(t *testing.T) {
+	size := int64(3*blockSize + 123)
+	full, _ := io.ReadAll(NewReader(ModeBlock, 5, size))
+	if !bytes.Equal(full[:blockSize], full[blockSize:2*blockSize]) {
+		t.Errorf("Expected the block payload to repeat after %d bytes", blockSize)
+	}
+	other, _ := io.ReadAll(NewReader(ModeBlock, 6, size))
+	if bytes.Equal(full, other) {
+		t.Errorf("Expected block payloads with different seeds to differ")
+	}
+
+	// reads across the end of the block
+	reader := NewReader(ModeBlock, 5, size)
+	for _, offset := range []int64{0, blockSize - 3, 2*blockSize - 1000, size - 10} {
+		p := make([]byte, 2000)
+		n, _ := reader.ReadAt(p, offset)
+		if !bytes.Equal(p[:n], full[offset:offset+int64(n)]) {
+			t.Errorf("Expected bytes at offset %d to match the sequential read", offset)
+		}
+	}
+}
+
+func BenchmarkReader(b *testing.B) {
+	for _, mode := range []Mode{ModeRandom, ModeCompressible, ModeZero, ModeBlock} {
+		b.Run(string(mode), func(b *testing.B) {
+			reader := NewReader(mode, 1, 1<<62)
+			buffer := make([]byte, 256*1024)
+			b.SetBytes(int64(len(buffer)))
+			for i := 0; i < b.N; i++ {
+				reader.Read(buffer)
+			}
+		})
+	}
+}
+
+func TestCompressibility(t *testing.T) {
+	ratio := func(mode Mode) float64 {
+		compressed := bytes.Buffer{}
+		writer := gzip.NewWriter(&compressed)
+		io.Copy(writer, NewReader(mode, 3, 1024*1024))
+		writer.Close()
+		return float64(compressed.Len()) / (1024 * 1024)
+	}
+	if r := ratio(ModeRandom); r < 0.99 {
+		t.Errorf("Expected random payload to be incompressible but got ratio %.2f", r)
+	}
+	if r := ratio(ModeCompressible); r > 0.5 {
+		t.Errorf("Expected compressible payload to compress below 50%% but got ratio %.2f", r)
+	}
+	if r := ratio(ModeBlock); r < 0.99 {
+		t.Errorf("Expected block payload to be incompressible for gzip but got ratio %.2f", r)
+	}
+	if r := ratio(ModeZero); r > 0.01 {
+		t.Errorf("Expected zero payload to compress below 1%% but got ratio %.2f", r)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	verifier := NewVerifier(ModeRandom, 9, 100000)
+	if _, err := io.Copy(verifier, NewReader(ModeRandom, 9, 100000)); err != nil {
+		t.Errorf("Unexpected error verifying matching payload: %s", err)
+	}
+	if err := verifier.Verify(); err != nil {
+		t.Errorf("Unexpected verification error: %s", err)
+	}
+
+	corrupted, _ := io.ReadAll(NewReader(ModeRandom, 9, 100000))
+	corrupted[54321] ^= 0xff
+	verifier = NewVerifier(ModeRandom, 9, 100000)
+	io.Copy(verifier, bytes.NewReader(corrupted))
+	if err := verifier.Verify(); err == nil || err.Error() != "payload mismatch at byte 54321" {
+		t.Errorf("Expected mismatch at byte 54321 but got %v", err)
+	}
+
+	verifier = NewVerifier(ModeRandom, 9, 100000)
+	io.Copy(verifier, NewReader(ModeRandom, 9, 99999))
+	if err := verifier.Verify(); err == nil {
+		t.Errorf("Expected truncated payload to fail verification")
+	}
+
+	verifier = NewVerifier(ModeRandom, 9, 100000)
+	io.Copy(verifier, NewReader(ModeRandom, 9, 100001))
+	if err := verifier.Verify(); err == nil {
+		t.Errorf("Expected oversized payload to fail verification")
+	}
+}
@@ -0,0 +1,306 @@
+package s3mock_server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"github.com/mxcd/tester-toolbox/internal/util"
+)
+
+const (
+	signV4Algorithm        = "AWS4-HMAC-SHA256"
+	streamingPayload       = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingChunkAlgo     = "AWS4-HMAC-SHA256-PAYLOAD"
+	unsignedPayload        = "UNSIGNED-PAYLOAD"
+	iso8601Format          = "20060102T150405Z"
+	yyyymmdd               = "20060102"
+	maxClockSkew           = 15 * time.Minute
+	emptySHA256            = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	maxStreamingChunkBytes = 16 * 1024 * 1024
+)
+
+// signatureV4 holds the parsed authorization of a request signed with AWS signature version 4.
+type signatureV4 struct {
+	accessKey     string
+	date          time.Time
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	presigned     bool
+}
+
+func (s *signatureV4) scope() string {
+	return strings.Join([]string{s.date.Format(yyyymmdd), s.region, s.service, "aws4_request"}, "/")
+}
+
+func (s *signatureV4) signingKey(secretKey string) []byte {
+	key := sumHMAC([]byte("AWS4"+secretKey), []byte(s.date.Format(yyyymmdd)))
+	key = sumHMAC(key, []byte(s.region))
+	key = sumHMAC(key, []byte(s.service))
+	return sumHMAC(key, []byte("aws4_request"))
+}
+
+// parseSignatureV4 reads the signature from the Authorization header or,
+// for pre-signed URLs, from the query string.
+func parseSignatureV4(r *http.Request) (*signatureV4, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return parsePresignedSignatureV4(query)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, errAccessDenied
+	}
+	if !strings.HasPrefix(authorization, signV4Algorithm+" ") {
+		return nil, errSignatureVersionNotSupported
+	}
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(authorization, signV4Algorithm+" "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		fields[key] = value
+	}
+
+	date, err := time.Parse(iso8601Format, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	signature, err := parseCredential(fields["Credential"], date)
+	if err != nil {
+		return nil, err
+	}
+	signature.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	signature.signature = fields["Signature"]
+	if signature.signature == "" || fields["SignedHeaders"] == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	return signature, nil
+}
+
+func parsePresignedSignatureV4(query url.Values) (*signatureV4, error) {
+	if query.Get("X-Amz-Algorithm") != signV4Algorithm {
+		return nil, errSignatureVersionNotSupported
+	}
+	date, err := time.Parse(iso8601Format, query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAuthorizationQueryParametersError
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 {
+		return nil, errAuthorizationQueryParametersError
+	}
+	if time.Now().After(date.Add(time.Duration(expires) * time.Second)) {
+		return nil, errExpiredPresignRequest
+	}
+	signature, err := parseCredential(query.Get("X-Amz-Credential"), date)
+	if err != nil {
+		return nil, err
+	}
+	signature.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	signature.signature = query.Get("X-Amz-Signature")
+	signature.presigned = true
+	return signature, nil
+}
+
+func parseCredential(credential string, date time.Time) (*signatureV4, error) {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || parts[1] != date.Format(yyyymmdd) {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	return &signatureV4{accessKey: parts[0], date: date, region: parts[2], service: parts[3]}, nil
+}
+
+// verifySignatureV4 checks the request signature against the configured
+// credentials and returns the parsed signature for the payload checks.
+func (s *Server) verifySignatureV4(r *http.Request) (*signatureV4, error) {
+	signature, err := parseSignatureV4(r)
+	if err != nil {
+		return nil, err
+	}
+	if signature.accessKey != s.options.AccessKey {
+		return nil, errInvalidAccessKeyId
+	}
+	if !signature.presigned {
+		skew := time.Since(signature.date)
+		if skew > maxClockSkew || skew < -maxClockSkew {
+			return nil, errRequestTimeTooSkewed
+		}
+	}
+
+	hashedPayload := unsignedPayload
+	if !signature.presigned {
+		hashedPayload = r.Header.Get("X-Amz-Content-Sha256")
+		if hashedPayload == "" {
+			return nil, errMissingContentSha256
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		s3utils.EncodePath(r.URL.Path),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, signature.signedHeaders),
+		strings.Join(signature.signedHeaders, ";"),
+		hashedPayload,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		signature.date.Format(iso8601Format),
+		signature.scope(),
+		hex.EncodeToString(sum256([]byte(canonicalRequest))),
+	}, "\n")
+	expected := hex.EncodeToString(sumHMAC(signature.signingKey(s.options.SecretKey), []byte(stringToSign)))
+	if !hmac.Equal([]byte(expected), []byte(signature.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+	return signature, nil
+}
+
+func canonicalQuery(query url.Values) string {
+	query.Del("X-Amz-Signature")
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	headers := append([]string{}, signedHeaders...)
+	sort.Strings(headers)
+	buffer := bytes.Buffer{}
+	for _, header := range headers {
+		buffer.WriteString(header)
+		buffer.WriteByte(':')
+		switch header {
+		case "host":
+			buffer.WriteString(r.Host)
+		case "content-length":
+			buffer.WriteString(strconv.FormatInt(r.ContentLength, 10))
+		default:
+			values := r.Header.Values(header)
+			for i, value := range values {
+				if i > 0 {
+					buffer.WriteByte(',')
+				}
+				buffer.WriteString(strings.Join(strings.Fields(value), " "))
+			}
+		}
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
+// readPayload reads the request body and verifies it against the signed
+// payload hash, decoding aws-chunked streaming uploads on the way.
+func (s *Server) readPayload(r *http.Request, signature *signatureV4) ([]byte, error) {
+	hashedPayload := r.Header.Get("X-Amz-Content-Sha256")
+	switch {
+	case signature.presigned || hashedPayload == unsignedPayload:
+		return io.ReadAll(r.Body)
+	case hashedPayload == streamingPayload:
+		return s.readStreamingPayload(r, signature)
+	default:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(sum256(data)) != hashedPayload {
+			return nil, errXAmzContentSHA256Mismatch
+		}
+		return data, nil
+	}
+}
+
+// readStreamingPayload decodes a body in the aws-chunked format where every
+// chunk is signed with the signature of the previous chunk as seed.
+func (s *Server) readStreamingPayload(r *http.Request, signature *signatureV4) ([]byte, error) {
+	decodedLength, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+	if err != nil || decodedLength < 0 {
+		return nil, errMissingContentLength
+	}
+	if decodedLength > util.MaxObjectSize {
+		return nil, errEntityTooLarge
+	}
+
+	signingKey := signature.signingKey(s.options.SecretKey)
+	previousSignature := signature.signature
+	reader := bufio.NewReader(r.Body)
+	// the decoded length is only a claim of the client, the buffer grows
+	// with the chunks that actually arrive
+	data := bytes.NewBuffer(make([]byte, 0, min(decodedLength, maxStreamingChunkBytes)))
+
+	for {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, errIncompleteBody
+		}
+		sizeStr, chunkSignature, ok := strings.Cut(strings.TrimSuffix(header, "\r\n"), ";chunk-signature=")
+		if !ok {
+			return nil, errIncompleteBody
+		}
+		size, err := strconv.ParseInt(sizeStr, 16, 64)
+		if err != nil || size < 0 || size > maxStreamingChunkBytes || int64(data.Len())+size > decodedLength {
+			return nil, errIncompleteBody
+		}
+
+		chunk := make([]byte, size)
+		_, err = io.ReadFull(reader, chunk)
+		if err != nil {
+			return nil, errIncompleteBody
+		}
+		crlf := make([]byte, 2)
+		_, err = io.ReadFull(reader, crlf)
+		if err != nil || string(crlf) != "\r\n" {
+			return nil, errIncompleteBody
+		}
+
+		stringToSign := strings.Join([]string{
+			streamingChunkAlgo,
+			signature.date.Format(iso8601Format),
+			signature.scope(),
+			previousSignature,
+			emptySHA256,
+			hex.EncodeToString(sum256(chunk)),
+		}, "\n")
+		expected := hex.EncodeToString(sumHMAC(signingKey, []byte(stringToSign)))
+		if !hmac.Equal([]byte(expected), []byte(chunkSignature)) {
+			return nil, errSignatureDoesNotMatch
+		}
+		previousSignature = chunkSignature
+
+		if size == 0 {
+			break
+		}
+		data.Write(chunk)
+	}
+
+	if int64(data.Len()) != decodedLength {
+		return nil, fmt.Errorf("%w: decoded %d of %d bytes", errIncompleteBody, data.Len(), decodedLength)
+	}
+	return data.Bytes(), nil
+}
+
+func sum256(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+func sumHMAC(key []byte, data []byte) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write(data)
+	return hash.Sum(nil)
+}
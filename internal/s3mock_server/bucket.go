@@ -0,0 +1,320 @@
+package s3mock_server
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxListKeys = 1000
+
+type bucket struct {
+	created time.Time
+	objects map[string]*object
+	uploads map[string]*multipartUpload
+}
+
+func newBucket() *bucket {
+	return &bucket{
+		created: time.Now().UTC(),
+		objects: make(map[string]*object),
+		uploads: make(map[string]*multipartUpload),
+	}
+}
+
+// getBucket returns the bucket with the given name. The caller must not hold the lock.
+func (s *Server) getBucket(name string) (*bucket, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lookupBucket(name)
+}
+
+// lookupBucket returns the bucket with the given name. The caller must hold the lock.
+func (s *Server) lookupBucket(name string) (*bucket, error) {
+	bucket, ok := s.buckets[name]
+	if !ok {
+		return nil, errNoSuchBucket
+	}
+	return bucket, nil
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   owner         `xml:"Owner"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	s.mutex.Lock()
+	names := make([]string, 0, len(s.buckets))
+	for name := range s.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := &listAllMyBucketsResult{Owner: owner{ID: s.options.AccessKey, DisplayName: s.options.AccessKey}}
+	for _, name := range names {
+		result.Buckets = append(result.Buckets, bucketEntry{name, s.buckets[name].created.Format(time.RFC3339)})
+	}
+	s.mutex.Unlock()
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (s *Server) putBucket(w http.ResponseWriter, r *http.Request, signature *signatureV4, name string) error {
+	if !validBucketName(name) {
+		return errInvalidBucketName
+	}
+	_, err := s.readPayload(r, signature)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.buckets[name]; ok {
+		return errBucketAlreadyOwnedByYou
+	}
+	s.buckets[name] = newBucket()
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) deleteBucket(w http.ResponseWriter, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bucket, err := s.lookupBucket(name)
+	if err != nil {
+		return err
+	}
+	if len(bucket.objects) > 0 || len(bucket.uploads) > 0 {
+		return errBucketNotEmpty
+	}
+	delete(s.buckets, name)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+// getBucketLocation reports the region the client signed with, so any region is accepted.
+func (s *Server) getBucketLocation(w http.ResponseWriter, signature *signatureV4, name string) error {
+	_, err := s.getBucket(name)
+	if err != nil {
+		return err
+	}
+	location := signature.region
+	if location == "us-east-1" {
+		location = ""
+	}
+	writeXML(w, http.StatusOK, &locationConstraint{Location: location})
+	return nil
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+}
+
+// getBucketVersioning reports that versioning was never enabled, which is always true for the mock.
+func (s *Server) getBucketVersioning(w http.ResponseWriter, name string) error {
+	_, err := s.getBucket(name)
+	if err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, &versioningConfiguration{})
+	return nil
+}
+
+type listObjectsContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name             `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string               `xml:"Name"`
+	Prefix                string               `xml:"Prefix"`
+	Delimiter             string               `xml:"Delimiter,omitempty"`
+	MaxKeys               int                  `xml:"MaxKeys"`
+	IsTruncated           bool                 `xml:"IsTruncated"`
+	Marker                string               `xml:"Marker,omitempty"`
+	NextMarker            string               `xml:"NextMarker,omitempty"`
+	ContinuationToken     string               `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string               `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string               `xml:"StartAfter,omitempty"`
+	KeyCount              *int                 `xml:"KeyCount,omitempty"`
+	Contents              []listObjectsContent `xml:"Contents"`
+	CommonPrefixes        []commonPrefix       `xml:"CommonPrefixes"`
+}
+
+// listObjects implements ListObjects and ListObjectsV2. Version 2 uses an
+// opaque continuation token, version 1 the last returned key as marker.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, name string, v2 bool) error {
+	query := r.URL.Query()
+	result := &listBucketResult{
+		Name:      name,
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxListKeys,
+	}
+	if query.Has("max-keys") {
+		maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+		if err != nil || maxKeys < 0 {
+			return errInvalidArgument
+		}
+		if maxKeys < maxListKeys {
+			result.MaxKeys = maxKeys
+		}
+	}
+
+	after := query.Get("marker")
+	if v2 {
+		result.StartAfter = query.Get("start-after")
+		result.ContinuationToken = query.Get("continuation-token")
+		after = result.StartAfter
+		if result.ContinuationToken != "" {
+			token, err := base64.StdEncoding.DecodeString(result.ContinuationToken)
+			if err != nil {
+				return errInvalidArgument
+			}
+			after = string(token)
+		}
+	} else {
+		result.Marker = after
+	}
+
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(name)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	keys := make([]string, 0, len(bucket.objects))
+	for key := range bucket.objects {
+		if strings.HasPrefix(key, result.Prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	last := ""
+	for _, key := range keys {
+		// a marker that is a common prefix skips all keys below it
+		if result.Delimiter != "" && strings.HasSuffix(after, result.Delimiter) && strings.HasPrefix(key, after) {
+			continue
+		}
+		entry := key
+		if result.Delimiter != "" {
+			index := strings.Index(key[len(result.Prefix):], result.Delimiter)
+			if index >= 0 {
+				entry = key[:len(result.Prefix)+index+len(result.Delimiter)]
+			}
+		}
+		if entry == last {
+			continue
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) >= result.MaxKeys {
+			result.IsTruncated = true
+			break
+		}
+		last = entry
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{entry})
+			continue
+		}
+		object := bucket.objects[key]
+		result.Contents = append(result.Contents, listObjectsContent{
+			Key:          key,
+			LastModified: object.lastModified.Format(time.RFC3339Nano),
+			ETag:         object.quotedETag(),
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	s.mutex.Unlock()
+
+	if result.IsTruncated {
+		if v2 {
+			result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		} else {
+			result.NextMarker = last
+		}
+	}
+	if v2 {
+		keyCount := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &keyCount
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+type objectIdentifier struct {
+	Key string `xml:"Key"`
+}
+
+type deleteObjectsRequest struct {
+	Quiet   bool               `xml:"Quiet"`
+	Objects []objectIdentifier `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name           `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []objectIdentifier `xml:"Deleted"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, signature *signatureV4, name string) error {
+	data, err := s.readPayload(r, signature)
+	if err != nil {
+		return err
+	}
+	request := deleteObjectsRequest{}
+	err = xml.Unmarshal(data, &request)
+	if err != nil {
+		return errMalformedXML
+	}
+
+	result := &deleteResult{}
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(name)
+	if err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	for _, object := range request.Objects {
+		delete(bucket.objects, object.Key)
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, object)
+		}
+	}
+	s.mutex.Unlock()
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
@@ -0,0 +1,96 @@
+package s3mock_server
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// apiError is an S3 error response with its error code and HTTP status.
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                      = &apiError{"AccessDenied", "Access Denied.", http.StatusForbidden}
+	errAuthorizationHeaderMalformed      = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errAuthorizationQueryParametersError = &apiError{"AuthorizationQueryParametersError", "The authorization query parameters are malformed.", http.StatusBadRequest}
+	errBucketAlreadyOwnedByYou           = &apiError{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", http.StatusConflict}
+	errBucketNotEmpty                    = &apiError{"BucketNotEmpty", "The bucket you tried to delete is not empty.", http.StatusConflict}
+	errEntityTooLarge                    = &apiError{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size.", http.StatusBadRequest}
+	errEntityTooSmall                    = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errExpiredPresignRequest             = &apiError{"AccessDenied", "Request has expired.", http.StatusForbidden}
+	errIncompleteBody                    = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	errInternalError                     = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errInvalidAccessKeyId                = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errInvalidArgument                   = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidBucketName                 = &apiError{"InvalidBucketName", "The specified bucket is not valid.", http.StatusBadRequest}
+	errInvalidPart                       = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder                  = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errInvalidRange                      = &apiError{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	errMalformedXML                      = &apiError{"MalformedXML", "The XML you provided was not well-formed.", http.StatusBadRequest}
+	errMethodNotAllowed                  = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errMissingContentLength              = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	errMissingContentSha256              = &apiError{"InvalidRequest", "Missing required header for this request: x-amz-content-sha256.", http.StatusBadRequest}
+	errNoSuchBucket                      = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey                         = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload                      = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented                    = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errObjectLockConfigurationNotFound   = &apiError{"ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket.", http.StatusNotFound}
+	errRequestTimeTooSkewed              = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errSignatureDoesNotMatch             = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	errSignatureVersionNotSupported      = &apiError{"AccessDenied", "Only AWS signature version 4 is supported.", http.StatusBadRequest}
+	errSlowDown                          = &apiError{"SlowDown", "Please reduce your request rate.", http.StatusServiceUnavailable}
+	errXAmzContentSHA256Mismatch         = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+)
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestId string   `xml:"RequestId"`
+}
+
+// writeError sends err as S3 XML error response. Errors that are not S3
+// errors are reported as internal errors.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	s3Error := &apiError{}
+	if !errors.As(err, &s3Error) {
+		log.Error().Err(err).Msgf("Failed to handle %s %s", r.Method, r.URL.Path)
+		s3Error = errInternalError
+	}
+	log.Debug().Msgf("%s %s: %s", r.Method, r.URL.Path, s3Error.Code)
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(s3Error.StatusCode)
+		return
+	}
+	writeXML(w, s3Error.StatusCode, &errorResponse{
+		Code:      s3Error.Code,
+		Message:   s3Error.Message,
+		Resource:  r.URL.Path,
+		RequestId: w.Header().Get("X-Amz-Request-Id"),
+	})
+}
+
+func writeXML(w http.ResponseWriter, statusCode int, response any) {
+	data, err := xml.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode XML response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
@@ -0,0 +1,184 @@
+package s3mock_server
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxPartNumber = 10000
+	minPartSize   = 5 * 1024 * 1024
+)
+
+type multipartUpload struct {
+	key    string
+	header http.Header
+	parts  map[int]*object
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadId string   `xml:"UploadId"`
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, key string) error {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return err
+	}
+	uploadId := hex.EncodeToString(id)
+
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(bucketName)
+	if err == nil {
+		bucket.uploads[uploadId] = &multipartUpload{key: key, header: r.Header.Clone(), parts: make(map[int]*object)}
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{Bucket: bucketName, Key: key, UploadId: uploadId})
+	return nil
+}
+
+// lookupUpload returns the multipart upload of key. The caller must hold the lock.
+func (s *Server) lookupUpload(bucketName string, key string, uploadId string) (*bucket, *multipartUpload, error) {
+	bucket, err := s.lookupBucket(bucketName)
+	if err != nil {
+		return nil, nil, err
+	}
+	upload, ok := bucket.uploads[uploadId]
+	if !ok || upload.key != key {
+		return nil, nil, errNoSuchUpload
+	}
+	return bucket, upload, nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, signature *signatureV4, bucketName string, key string) error {
+	query := r.URL.Query()
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		return errInvalidArgument
+	}
+	data, err := s.readPayload(r, signature)
+	if err != nil {
+		return err
+	}
+	err = checkContentMD5(r, data)
+	if err != nil {
+		return err
+	}
+	part := &object{data: data, etag: md5Hex(data)}
+
+	s.mutex.Lock()
+	_, upload, err := s.lookupUpload(bucketName, key, query.Get("uploadId"))
+	if err == nil {
+		upload.parts[partNumber] = part
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", part.quotedETag())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// completeMultipartUpload joins the listed parts into an object. Like S3,
+// every part except the last must be at least 5MiB and the ETag is the MD5
+// of the part MD5s followed by the number of parts.
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, signature *signatureV4, bucketName string, key string, uploadId string) error {
+	body, err := s.readPayload(r, signature)
+	if err != nil {
+		return err
+	}
+	request := completeMultipartUpload{}
+	err = xml.Unmarshal(body, &request)
+	if err != nil || len(request.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bucket, upload, err := s.lookupUpload(bucketName, key, uploadId)
+	if err != nil {
+		return err
+	}
+
+	size := 0
+	parts := make([]*object, len(request.Parts))
+	for i, requested := range request.Parts {
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		part, ok := upload.parts[requested.PartNumber]
+		if !ok || strings.Trim(requested.ETag, `"`) != part.etag {
+			return errInvalidPart
+		}
+		if i < len(request.Parts)-1 && len(part.data) < minPartSize {
+			return errEntityTooSmall
+		}
+		parts[i] = part
+		size += len(part.data)
+	}
+
+	data := make([]byte, 0, size)
+	hashes := make([]byte, 0, md5.Size*len(parts))
+	for _, part := range parts {
+		data = append(data, part.data...)
+		hash, _ := hex.DecodeString(part.etag)
+		hashes = append(hashes, hash...)
+	}
+	etag := fmt.Sprintf("%s-%d", md5Hex(hashes), len(parts))
+	object := newObject(data, etag, upload.header)
+	bucket.objects[key] = object
+	delete(bucket.uploads, uploadId)
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Location: "/" + bucketName + "/" + key,
+		Bucket:   bucketName,
+		Key:      key,
+		ETag:     object.quotedETag(),
+	})
+	return nil
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, bucketName string, key string, uploadId string) error {
+	s.mutex.Lock()
+	bucket, _, err := s.lookupUpload(bucketName, key, uploadId)
+	if err == nil {
+		delete(bucket.uploads, uploadId)
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,289 @@
+package s3mock_server
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object is an immutable stored object. Overwrites replace the whole object,
+// so its data can be served without holding the server lock.
+type object struct {
+	data         []byte
+	etag         string
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+}
+
+func newObject(data []byte, etag string, header http.Header) *object {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	return &object{
+		data:         data,
+		etag:         etag,
+		contentType:  contentType,
+		metadata:     userMetadata(header),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func (o *object) quotedETag() string {
+	return `"` + o.etag + `"`
+}
+
+// userMetadata collects the x-amz-meta-* headers of a request.
+func userMetadata(header http.Header) map[string]string {
+	metadata := make(map[string]string)
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[http.CanonicalHeaderKey(name)] = strings.Join(values, ",")
+		}
+	}
+	return metadata
+}
+
+func md5Hex(data []byte) string {
+	hash := md5.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, signature *signatureV4, bucketName string, key string) error {
+	data, err := s.readPayload(r, signature)
+	if err != nil {
+		return err
+	}
+	err = checkContentMD5(r, data)
+	if err != nil {
+		return err
+	}
+	object := newObject(data, md5Hex(data), r.Header)
+
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(bucketName)
+	if err == nil {
+		bucket.objects[key] = object
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", object.quotedETag())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func checkContentMD5(r *http.Request, data []byte) error {
+	contentMD5 := r.Header.Get("Content-Md5")
+	if contentMD5 == "" {
+		return nil
+	}
+	hash := md5.Sum(data)
+	if contentMD5 != base64.StdEncoding.EncodeToString(hash[:]) {
+		return &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	}
+	return nil
+}
+
+func (s *Server) lookupObject(bucketName string, key string) (*object, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bucket, err := s.lookupBucket(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := bucket.objects[key]
+	if !ok {
+		return nil, errNoSuchKey
+	}
+	return object, nil
+}
+
+// getObject serves GET and HEAD requests including a single byte range and
+// the If-Match and If-None-Match preconditions.
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName string, key string) error {
+	object, err := s.lookupObject(bucketName, key)
+	if err != nil {
+		return err
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && strings.Trim(ifMatch, `"`) != object.etag {
+		return &apiError{"PreconditionFailed", "At least one of the pre-conditions you specified did not hold.", http.StatusPreconditionFailed}
+	}
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" && strings.Trim(ifNoneMatch, `"`) == object.etag {
+		w.Header().Set("ETag", object.quotedETag())
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	size := int64(len(object.data))
+	start, end := int64(0), size-1
+	statusCode := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		var ok bool
+		start, end, ok, err = parseRange(rangeHeader, size)
+		if err != nil {
+			return err
+		}
+		if ok {
+			statusCode = http.StatusPartialContent
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+	}
+
+	header := w.Header()
+	for name, value := range object.metadata {
+		header.Set(name, value)
+	}
+	header.Set("Content-Type", object.contentType)
+	header.Set("ETag", object.quotedETag())
+	header.Set("Last-Modified", object.lastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	query := r.URL.Query()
+	for parameter, name := range responseHeaderOverrides {
+		if query.Has(parameter) {
+			header.Set(name, query.Get(parameter))
+		}
+	}
+	w.WriteHeader(statusCode)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	w.Write(object.data[start : end+1])
+	return nil
+}
+
+var responseHeaderOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-language":    "Content-Language",
+	"response-expires":             "Expires",
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+}
+
+// parseRange parses a byte range header for an object of the given size.
+// It reports false if the header should be ignored, which S3 does for
+// multiple ranges and malformed headers.
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size - 1, false, nil
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, size - 1, false, nil
+	}
+
+	var start, end int64
+	var err error
+	switch {
+	case first == "":
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size - 1, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size - 1, true, nil
+	case last == "":
+		start, err = strconv.ParseInt(first, 10, 64)
+		end = size - 1
+	default:
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err == nil {
+			end, err = strconv.ParseInt(last, 10, 64)
+		}
+	}
+	if err != nil {
+		return 0, size - 1, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	if end < start {
+		return 0, size - 1, false, nil
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end, true, nil
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, bucketName string, key string) error {
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(bucketName)
+	if err == nil {
+		delete(bucket.objects, key)
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, bucketName string, key string) error {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return errInvalidArgument
+	}
+	source, _, _ = strings.Cut(source, "?versionId=")
+	sourceBucket, sourceKey, ok := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok || sourceKey == "" {
+		return errInvalidArgument
+	}
+	sourceObject, err := s.lookupObject(sourceBucket, sourceKey)
+	if err != nil {
+		return err
+	}
+
+	object := *sourceObject
+	object.lastModified = time.Now().UTC().Truncate(time.Second)
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		replaced := newObject(object.data, object.etag, r.Header)
+		object.contentType = replaced.contentType
+		object.metadata = replaced.metadata
+	}
+
+	s.mutex.Lock()
+	bucket, err := s.lookupBucket(bucketName)
+	if err == nil {
+		bucket.objects[key] = &object
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, &copyObjectResult{
+		LastModified: object.lastModified.Format(time.RFC3339Nano),
+		ETag:         object.quotedETag(),
+	})
+	return nil
+}
@@ -0,0 +1,289 @@
+package s3mock_server
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Options configures the mock server.
+type Options struct {
+	AccessKey string
+	SecretKey string
+	// Latency is added to every request before it is handled.
+	Latency time.Duration
+	// Jitter adds a uniformly distributed random delay between zero and Jitter.
+	Jitter time.Duration
+	// SlowDownRate is the fraction of requests answered with 503 SlowDown.
+	SlowDownRate float64
+	// ErrorRate is the fraction of requests answered with 500 InternalError.
+	ErrorRate float64
+	// Seed initializes the random source of the injected jitter and errors.
+	// Zero uses the current time.
+	Seed int64
+}
+
+// Server is an in-memory S3 compatible server for tests and demos.
+// It supports path-style bucket and object operations, listings and
+// multipart uploads, and verifies AWS signature version 4 on every request.
+type Server struct {
+	options Options
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+
+	randomMutex sync.Mutex
+	random      *rand.Rand
+
+	requests atomic.Uint64
+}
+
+func NewServer(options Options) *Server {
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Server{
+		options: options,
+		buckets: make(map[string]*bucket),
+		random:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// CreateBucket creates an empty bucket. Creating an existing bucket is not an error.
+func (s *Server) CreateBucket(name string) error {
+	if !validBucketName(name) {
+		return errInvalidBucketName
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		s.buckets[name] = newBucket()
+	}
+	return nil
+}
+
+// Requests returns the number of requests received by the server,
+// including those that failed or were rejected by an injected error.
+func (s *Server) Requests() uint64 {
+	return s.requests.Load()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestId := s.requests.Add(1)
+	w.Header().Set("X-Amz-Request-Id", fmt.Sprintf("%016X", requestId))
+	w.Header().Set("Server", "s3-mock")
+
+	delay, injected := s.inject()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if injected != nil {
+		writeError(w, r, injected)
+		return
+	}
+
+	signature, err := s.verifySignatureV4(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.route(w, r, signature)
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// inject draws the latency and the injected error for a request.
+func (s *Server) inject() (time.Duration, error) {
+	s.randomMutex.Lock()
+	defer s.randomMutex.Unlock()
+
+	delay := s.options.Latency
+	if s.options.Jitter > 0 {
+		delay += time.Duration(s.random.Int63n(int64(s.options.Jitter)))
+	}
+
+	draw := s.random.Float64()
+	switch {
+	case draw < s.options.SlowDownRate:
+		return delay, errSlowDown
+	case draw < s.options.SlowDownRate+s.options.ErrorRate:
+		return delay, errInternalError
+	}
+	return delay, nil
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, signature *signatureV4) error {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return s.listBuckets(w, r)
+	}
+
+	bucketName, key, _ := strings.Cut(path, "/")
+	if key == "" {
+		return s.routeBucket(w, r, signature, bucketName)
+	}
+	return s.routeObject(w, r, signature, bucketName, key)
+}
+
+func (s *Server) routeBucket(w http.ResponseWriter, r *http.Request, signature *signatureV4, bucketName string) error {
+	query := requestParameters(r)
+	switch r.Method {
+	case http.MethodPut:
+		if len(query) > 0 || r.Header.Get("X-Amz-Bucket-Object-Lock-Enabled") == "true" {
+			return errNotImplemented
+		}
+		return s.putBucket(w, r, signature, bucketName)
+	case http.MethodHead:
+		_, err := s.getBucket(bucketName)
+		return err
+	case http.MethodDelete:
+		if len(query) > 0 {
+			return errNotImplemented
+		}
+		return s.deleteBucket(w, bucketName)
+	case http.MethodPost:
+		if query.Has("delete") {
+			return s.deleteObjects(w, r, signature, bucketName)
+		}
+		return errNotImplemented
+	case http.MethodGet:
+		switch {
+		case query.Has("location"):
+			return s.getBucketLocation(w, signature, bucketName)
+		case query.Has("versioning"):
+			return s.getBucketVersioning(w, bucketName)
+		case query.Has("object-lock"):
+			_, err := s.getBucket(bucketName)
+			if err != nil {
+				return err
+			}
+			return errObjectLockConfigurationNotFound
+		case query.Get("list-type") == "2":
+			return s.listObjects(w, r, bucketName, true)
+		case len(query) == 0 || onlyListParameters(query):
+			return s.listObjects(w, r, bucketName, false)
+		}
+		return errNotImplemented
+	}
+	return errMethodNotAllowed
+}
+
+func (s *Server) routeObject(w http.ResponseWriter, r *http.Request, signature *signatureV4, bucketName string, key string) error {
+	if r.Header.Get("X-Amz-Server-Side-Encryption") != "" || r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "" {
+		return errNotImplemented
+	}
+
+	query := requestParameters(r)
+	uploadId := query.Get("uploadId")
+	switch r.Method {
+	case http.MethodPut:
+		switch {
+		case uploadId != "":
+			return s.uploadPart(w, r, signature, bucketName, key)
+		case len(query) > 0:
+			return errNotImplemented
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			return s.copyObject(w, r, bucketName, key)
+		}
+		return s.putObject(w, r, signature, bucketName, key)
+	case http.MethodGet, http.MethodHead:
+		if len(query) > 0 && !onlyResponseParameters(query) {
+			return errNotImplemented
+		}
+		return s.getObject(w, r, bucketName, key)
+	case http.MethodDelete:
+		if uploadId != "" {
+			return s.abortMultipartUpload(w, bucketName, key, uploadId)
+		}
+		if len(query) > 0 {
+			return errNotImplemented
+		}
+		return s.deleteObject(w, bucketName, key)
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			return s.createMultipartUpload(w, r, bucketName, key)
+		case uploadId != "":
+			return s.completeMultipartUpload(w, r, signature, bucketName, key, uploadId)
+		}
+		return errNotImplemented
+	}
+	return errMethodNotAllowed
+}
+
+// requestParameters returns the query of r without the parameters of pre-signed URLs.
+func requestParameters(r *http.Request) url.Values {
+	query := r.URL.Query()
+	for parameter := range query {
+		if strings.HasPrefix(parameter, "X-Amz-") {
+			query.Del(parameter)
+		}
+	}
+	return query
+}
+
+func onlyListParameters(query url.Values) bool {
+	for parameter := range query {
+		switch parameter {
+		case "prefix", "delimiter", "marker", "max-keys", "encoding-type":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func onlyResponseParameters(query url.Values) bool {
+	for parameter := range query {
+		if !strings.HasPrefix(parameter, "response-") {
+			return false
+		}
+	}
+	return true
+}
+
+// validBucketName checks the basic S3 bucket naming rules.
+func validBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case (c == '-' || c == '.') && i > 0 && i < len(name)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// StartServer serves the mock on the given address until the listener fails.
+func StartServer(listen string, options Options, buckets ...string) error {
+	server := NewServer(options)
+	for _, name := range buckets {
+		err := server.CreateBucket(name)
+		if err != nil {
+			return fmt.Errorf("invalid bucket '%s': %w", name, err)
+		}
+	}
+	log.Info().Msgf("Starting S3 mock server on %s", listen)
+	return http.ListenAndServe(listen, server)
+}
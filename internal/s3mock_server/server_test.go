@@ -0,0 +1,333 @@
+package s3mock_server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+	testBucket    = "test-bucket"
+)
+
+func newTestServer(t *testing.T, options Options) (*Server, *httptest.Server) {
+	options.AccessKey = testAccessKey
+	options.SecretKey = testSecretKey
+	server := NewServer(options)
+	err := server.CreateBucket(testBucket)
+	if err != nil {
+		t.Fatalf("Failed to create bucket: %s", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+func newTestClient(t *testing.T, httpServer *httptest.Server, accessKey string, secretKey string) *minio.Client {
+	endpoint, _ := url.Parse(httpServer.URL)
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: false,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+	return client
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	_, httpServer := newTestServer(t, Options{})
+	client := newTestClient(t, httpServer, testAccessKey, testSecretKey)
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("0123456789"), 20000)
+	info, err := client.PutObject(ctx, testBucket, "dir/object", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  "text/plain",
+		UserMetadata: map[string]string{"Purpose": "test"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to upload object: %s", err)
+	}
+	if info.ETag != md5Hex(data) {
+		t.Errorf("Expected ETag %s but got %s", md5Hex(data), info.ETag)
+	}
+
+	object, err := client.GetObject(ctx, testBucket, "dir/object", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get object: %s", err)
+	}
+	downloaded, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("Failed to download object: %s", err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Downloaded data does not match uploaded data")
+	}
+
+	stat, err := client.StatObject(ctx, testBucket, "dir/object", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatalf("Failed to stat object: %s", err)
+	}
+	if stat.Size != int64(len(data)) || stat.ContentType != "text/plain" || stat.UserMetadata["Purpose"] != "test" {
+		t.Errorf("Unexpected object info: size %d, content type %s, metadata %v", stat.Size, stat.ContentType, stat.UserMetadata)
+	}
+
+	rangeOptions := minio.GetObjectOptions{}
+	rangeOptions.SetRange(10, 24)
+	object, err = client.GetObject(ctx, testBucket, "dir/object", rangeOptions)
+	if err != nil {
+		t.Fatalf("Failed to get object range: %s", err)
+	}
+	downloaded, _ = io.ReadAll(object)
+	if string(downloaded) != "012345678901234" {
+		t.Errorf("Expected range '012345678901234' but got '%s'", downloaded)
+	}
+
+	err = client.RemoveObject(ctx, testBucket, "dir/object", minio.RemoveObjectOptions{})
+	if err != nil {
+		t.Fatalf("Failed to remove object: %s", err)
+	}
+	_, err = client.StatObject(ctx, testBucket, "dir/object", minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		t.Errorf("Expected NoSuchKey after removal but got %v", err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	_, httpServer := newTestServer(t, Options{})
+	client := newTestClient(t, httpServer, testAccessKey, testSecretKey)
+	ctx := context.Background()
+
+	keys := []string{"a/1", "a/2", "b/1", "c", "d/e/1"}
+	for _, key := range keys {
+		_, err := client.PutObject(ctx, testBucket, key, strings.NewReader(key), int64(len(key)), minio.PutObjectOptions{})
+		if err != nil {
+			t.Fatalf("Failed to upload '%s': %s", key, err)
+		}
+	}
+
+	list := func(options minio.ListObjectsOptions) []string {
+		entries := []string{}
+		for info := range client.ListObjects(ctx, testBucket, options) {
+			if info.Err != nil {
+				t.Fatalf("Failed to list objects: %s", info.Err)
+			}
+			entries = append(entries, info.Key)
+		}
+		return entries
+	}
+
+	for _, v1 := range []bool{false, true} {
+		all := list(minio.ListObjectsOptions{Recursive: true, MaxKeys: 2, UseV1: v1})
+		if strings.Join(all, ",") != strings.Join(keys, ",") {
+			t.Errorf("Expected paginated listing %v but got %v", keys, all)
+		}
+		top := list(minio.ListObjectsOptions{MaxKeys: 1, UseV1: v1})
+		if strings.Join(top, ",") != "a/,b/,c,d/" {
+			t.Errorf("Expected top level entries a/,b/,c,d/ but got %v", top)
+		}
+	}
+	prefixed := list(minio.ListObjectsOptions{Prefix: "d/"})
+	if strings.Join(prefixed, ",") != "d/e/" {
+		t.Errorf("Expected common prefix d/e/ but got %v", prefixed)
+	}
+
+	err := client.RemoveBucket(ctx, testBucket)
+	if minio.ToErrorResponse(err).Code != "BucketNotEmpty" {
+		t.Errorf("Expected BucketNotEmpty but got %v", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	_, httpServer := newTestServer(t, Options{})
+	client := newTestClient(t, httpServer, testAccessKey, testSecretKey)
+	ctx := context.Background()
+
+	data := make([]byte, 11*1024*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	info, err := client.PutObject(ctx, testBucket, "multipart", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		PartSize:         minPartSize,
+		DisableMultipart: false,
+	})
+	if err != nil {
+		t.Fatalf("Failed to upload multipart object: %s", err)
+	}
+	if !strings.HasSuffix(info.ETag, "-3") {
+		t.Errorf("Expected multipart ETag with 3 parts but got %s", info.ETag)
+	}
+
+	object, err := client.GetObject(ctx, testBucket, "multipart", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get object: %s", err)
+	}
+	downloaded, _ := io.ReadAll(object)
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Downloaded multipart object does not match uploaded data")
+	}
+}
+
+func TestSignatureVerification(t *testing.T) {
+	_, httpServer := newTestServer(t, Options{})
+	ctx := context.Background()
+
+	_, err := newTestClient(t, httpServer, testAccessKey, "wrong-secret").BucketExists(ctx, testBucket)
+	if err == nil {
+		t.Errorf("Expected request with wrong secret key to fail")
+	}
+	_, err = newTestClient(t, httpServer, testAccessKey, "wrong-secret").PutObject(ctx, testBucket, "object", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "SignatureDoesNotMatch" {
+		t.Errorf("Expected SignatureDoesNotMatch but got %v", err)
+	}
+	_, err = newTestClient(t, httpServer, "wrong-access-key", testSecretKey).PutObject(ctx, testBucket, "object", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	if minio.ToErrorResponse(err).Code != "InvalidAccessKeyId" {
+		t.Errorf("Expected InvalidAccessKeyId but got %v", err)
+	}
+
+	response, err := http.Get(httpServer.URL + "/" + testBucket + "/object")
+	if err != nil {
+		t.Fatalf("Failed to send anonymous request: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected anonymous request to be forbidden but got status %d", response.StatusCode)
+	}
+
+	client := newTestClient(t, httpServer, testAccessKey, testSecretKey)
+	_, err = client.PutObject(ctx, testBucket, "object", strings.NewReader("data"), 4, minio.PutObjectOptions{})
+	if err != nil {
+		t.Fatalf("Failed to upload object: %s", err)
+	}
+	presigned, err := client.PresignedGetObject(ctx, testBucket, "object", time.Minute, nil)
+	if err != nil {
+		t.Fatalf("Failed to presign URL: %s", err)
+	}
+	response, err = http.Get(presigned.String())
+	if err != nil {
+		t.Fatalf("Failed to get presigned URL: %s", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(body) != "data" {
+		t.Errorf("Expected presigned download of 'data' but got status %d and '%s'", response.StatusCode, body)
+	}
+
+	tampered := strings.Replace(presigned.String(), "/object?", "/other?", 1)
+	response, err = http.Get(tampered)
+	if err != nil {
+		t.Fatalf("Failed to get tampered URL: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected tampered presigned URL to be forbidden but got status %d", response.StatusCode)
+	}
+}
+
+func TestStreamingPayloadLength(t *testing.T) {
+	_, httpServer := newTestServer(t, Options{})
+	tests := []struct {
+		name          string
+		decodedLength int64
+		statusCode    int
+		code          string
+	}{
+		{"beyond int", 1 << 62, http.StatusBadRequest, "<Code>EntityTooLarge</Code>"},
+		{"beyond the object size limit", 6 << 40, http.StatusBadRequest, "<Code>EntityTooLarge</Code>"},
+		// a claimed terabyte must not be allocated before the data arrives
+		{"terabyte", 1 << 40, http.StatusForbidden, "<Code>SignatureDoesNotMatch</Code>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPut, httpServer.URL+"/"+testBucket+"/object", nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %s", err)
+			}
+			request = signer.StreamingSignV4(request, testAccessKey, testSecretKey, "", "us-east-1", test.decodedLength, time.Now().UTC(), nil)
+			chunk := "4;chunk-signature=" + strings.Repeat("0", 64) + "\r\ndata\r\n"
+			request.Body = io.NopCloser(strings.NewReader(chunk))
+			request.ContentLength = int64(len(chunk))
+
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatalf("Request failed: %s", err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if response.StatusCode != test.statusCode || !strings.Contains(string(body), test.code) {
+				t.Errorf("Expected status %d with %s but got %d: %s", test.statusCode, test.code, response.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestInjection(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		statusCode int
+		code       string
+	}{
+		{"slowdown", Options{SlowDownRate: 1}, http.StatusServiceUnavailable, "<Code>SlowDown</Code>"},
+		{"error", Options{ErrorRate: 1}, http.StatusInternalServerError, "<Code>InternalError</Code>"},
+		{"latency", Options{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond}, http.StatusForbidden, "<Code>AccessDenied</Code>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, httpServer := newTestServer(t, test.options)
+			start := time.Now()
+			response, err := http.Get(httpServer.URL + "/" + testBucket)
+			if err != nil {
+				t.Fatalf("Request failed: %s", err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if response.StatusCode != test.statusCode || !strings.Contains(string(body), test.code) {
+				t.Errorf("Expected status %d with %s but got %d: %s", test.statusCode, test.code, response.StatusCode, body)
+			}
+			if elapsed := time.Since(start); elapsed < test.options.Latency {
+				t.Errorf("Expected at least %s latency but got %s", test.options.Latency, elapsed)
+			}
+			if server.Requests() != 1 {
+				t.Errorf("Expected 1 request but got %d", server.Requests())
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+		err        error
+	}{
+		{"bytes=0-9", 0, 9, true, nil},
+		{"bytes=10-", 10, 99, true, nil},
+		{"bytes=-10", 90, 99, true, nil},
+		{"bytes=-1000", 0, 99, true, nil},
+		{"bytes=50-1000", 50, 99, true, nil},
+		{"bytes=100-", 0, 0, false, errInvalidRange},
+		{"bytes=0-1,5-6", 0, 99, false, nil},
+		{"bytes=9-0", 0, 99, false, nil},
+		{"items=0-9", 0, 99, false, nil},
+	}
+	for _, test := range tests {
+		start, end, ok, err := parseRange(test.header, 100)
+		if start != test.start || end != test.end || ok != test.ok || err != test.err {
+			t.Errorf("parseRange(%q) = %d, %d, %t, %v; expected %d, %d, %t, %v", test.header, start, end, ok, err, test.start, test.end, test.ok, test.err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package testload_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures a benchmark. It runs until Duration has passed or
+// TotalSize bytes have been downloaded, whichever comes first.
+type Options struct {
+	URL         string
+	Connections int
+	// Duration limits the run, zero runs until TotalSize is reached
+	Duration time.Duration
+	// TotalSize limits the downloaded bytes, zero runs for Duration
+	TotalSize int64
+	// Protocol is one of Protocols, empty negotiates like ProtocolAuto
+	Protocol string
+	// Insecure skips the verification of TLS certificates
+	Insecure bool
+}
+
+const (
+	// ProtocolAuto uses h2 if the TLS server offers it and HTTP/1.1 otherwise
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	// ProtocolHTTP2 requires h2 over TLS or h2c for http URLs
+	ProtocolHTTP2 = "http2"
+	ProtocolHTTP3 = "http3"
+)
+
+var Protocols = []string{ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2, ProtocolHTTP3}
+
+func (o *Options) Validate() error {
+	if o.URL == "" {
+		return errors.New("url must not be empty")
+	}
+	if o.Connections < 1 {
+		return fmt.Errorf("connections must be at least 1, got %d", o.Connections)
+	}
+	if o.Duration < 0 || o.TotalSize < 0 {
+		return errors.New("duration and total size must not be negative")
+	}
+	if o.Duration == 0 && o.TotalSize == 0 {
+		return errors.New("either a duration or a total size is required")
+	}
+	if o.Protocol != "" && !slices.Contains(Protocols, o.Protocol) {
+		return fmt.Errorf("protocol '%s' not recognized, use one of %s", o.Protocol, strings.Join(Protocols, ", "))
+	}
+	return nil
+}
+
+// Results of a benchmark. Downloads cut off by the end of the run count
+// towards the bytes and the connection speeds, but not towards the
+// download speeds.
+type Results struct {
+	Elapsed time.Duration
+	Bytes   int64
+	// Protocols counts the responses per negotiated protocol, e.g. HTTP/2.0
+	Protocols map[string]int
+	// Downloads counts the completed downloads
+	Downloads int
+	// TTFBs are the times to the first response byte of completed downloads in milliseconds
+	TTFBs []float64
+	// DownloadSpeeds are the speeds of completed downloads in bytes per second
+	DownloadSpeeds []float64
+	// ConnectionSpeeds are the mean speeds of the connections in bytes per second
+	ConnectionSpeeds []float64
+	Errors           map[string]int
+}
+
+// Throughput is the mean throughput of all connections in bytes per second.
+func (r *Results) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+// ErrorCount is the number of failed downloads.
+func (r *Results) ErrorCount() int {
+	count := 0
+	for _, errors := range r.Errors {
+		count += errors
+	}
+	return count
+}
+
+// errorBackoff keeps a connection from hammering a failing server.
+const errorBackoff = 100 * time.Millisecond
+
+// bench is the state shared by the connections of a run.
+type bench struct {
+	options Options
+	ctx     context.Context
+	stop    context.CancelFunc
+	total   atomic.Int64
+
+	mutex   sync.Mutex
+	results *Results
+}
+
+// Bench downloads options.URL over and over on parallel connections.
+func Bench(ctx context.Context, options Options) (*Results, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, options.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var stop context.CancelFunc
+	if options.Duration > 0 {
+		ctx, stop = context.WithTimeout(ctx, options.Duration)
+	} else {
+		ctx, stop = context.WithCancel(ctx)
+	}
+	defer stop()
+
+	b := &bench{
+		options: options,
+		ctx:     ctx,
+		stop:    stop,
+		results: &Results{Protocols: make(map[string]int), Errors: make(map[string]int)},
+	}
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < options.Connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.connection(request, start)
+		}()
+	}
+	wg.Wait()
+
+	b.results.Elapsed = time.Since(start)
+	b.results.Bytes = b.total.Load()
+	if b.results.Downloads == 0 && b.results.Bytes == 0 && len(b.results.Errors) > 0 {
+		return b.results, fmt.Errorf("all downloads failed, e.g. with %s", firstError(b.results.Errors))
+	}
+	return b.results, nil
+}
+
+// connection downloads in a loop on its own connection until the run ends.
+func (b *bench) connection(request *http.Request, start time.Time) {
+	transport := newTransport(b.options)
+	defer transport.close()
+	client := &http.Client{Transport: transport}
+
+	var bytes int64
+	for b.ctx.Err() == nil {
+		n, err := b.download(client, request)
+		bytes += n
+		if err != nil && b.ctx.Err() == nil {
+			b.recordError(err)
+			select {
+			case <-time.After(errorBackoff):
+			case <-b.ctx.Done():
+			}
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.results.ConnectionSpeeds = append(b.results.ConnectionSpeeds, float64(bytes)/time.Since(start).Seconds())
+}
+
+// download fetches the URL once and returns the bytes received, also when
+// it is cut off by the end of the run.
+func (b *bench) download(client *http.Client, request *http.Request) (int64, error) {
+	start := time.Now()
+	var ttfb time.Duration
+	ctx := httptrace.WithClientTrace(b.ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { ttfb = time.Since(start) },
+	})
+	response, err := client.Do(request.Clone(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// the HTTP/3 transport does not trace the first byte, the headers are close
+	if ttfb == 0 {
+		ttfb = time.Since(start)
+	}
+	b.recordProtocol(response.Proto)
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusPartialContent {
+		io.Copy(io.Discard, response.Body)
+		return 0, fmt.Errorf("status %s", response.Status)
+	}
+
+	buffer := make([]byte, 32*1024)
+	var bytes int64
+	for {
+		n, err := response.Body.Read(buffer)
+		bytes += int64(n)
+		if b.add(int64(n)) {
+			b.stop()
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return bytes, err
+		}
+		// the body may hold buffered data after the run ended
+		if b.ctx.Err() != nil {
+			return bytes, b.ctx.Err()
+		}
+	}
+	elapsed := time.Since(start)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.results.Downloads++
+	b.results.TTFBs = append(b.results.TTFBs, float64(ttfb.Microseconds())/1000)
+	if elapsed > 0 {
+		b.results.DownloadSpeeds = append(b.results.DownloadSpeeds, float64(bytes)/elapsed.Seconds())
+	}
+	return bytes, nil
+}
+
+// add counts n downloaded bytes and reports whether the total size is reached.
+func (b *bench) add(n int64) bool {
+	total := b.total.Add(n)
+	return b.options.TotalSize > 0 && total >= b.options.TotalSize
+}
+
+func (b *bench) recordProtocol(protocol string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.results.Protocols[protocol]++
+}
+
+func (b *bench) recordError(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.results.Errors[err.Error()]++
+}
+
+func firstError(errors map[string]int) string {
+	for err := range errors {
+		return err
+	}
+	return ""
+}
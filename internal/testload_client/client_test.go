@@ -0,0 +1,177 @@
+package testload_client
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/testload_server"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(testload_server.NewServer(testload_server.Options{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBenchDuration(t *testing.T) {
+	server := newTestServer(t)
+	start := time.Now()
+	results, err := Bench(context.Background(), Options{URL: server.URL + "/load/64KiB", Connections: 2, Duration: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Benchmark failed: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the benchmark to take 300ms but it took %s", elapsed)
+	}
+	if results.Downloads == 0 || results.Bytes < int64(results.Downloads)*64*1024 {
+		t.Errorf("Expected complete downloads of 64KiB but got %d downloads with %d bytes", results.Downloads, results.Bytes)
+	}
+	if len(results.TTFBs) != results.Downloads || len(results.DownloadSpeeds) != results.Downloads {
+		t.Errorf("Expected a TTFB and speed per download")
+	}
+	if len(results.ConnectionSpeeds) != 2 || results.Throughput() <= 0 {
+		t.Errorf("Expected the speeds of 2 connections and a throughput but got %v and %f", results.ConnectionSpeeds, results.Throughput())
+	}
+	if results.ErrorCount() != 0 {
+		t.Errorf("Expected no errors but got %v", results.Errors)
+	}
+}
+
+func TestBenchTotalSize(t *testing.T) {
+	server := newTestServer(t)
+	results, err := Bench(context.Background(), Options{URL: server.URL + "/load/100KiB?rate=10MiB/s", Connections: 4, TotalSize: 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Benchmark failed: %s", err)
+	}
+	// the connections that are still downloading may add one chunk each
+	if results.Bytes < 1024*1024 || results.Bytes > 1024*1024+4*32*1024 {
+		t.Errorf("Expected to stop after 1MiB but got %d bytes", results.Bytes)
+	}
+}
+
+func TestBenchFailures(t *testing.T) {
+	server := newTestServer(t)
+	results, err := Bench(context.Background(), Options{URL: server.URL + "/missing", Connections: 1, Duration: 250 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("Expected an error if all downloads fail")
+	}
+	if results.Errors["status 404 Not Found"] == 0 {
+		t.Errorf("Expected 404 errors but got %v", results.Errors)
+	}
+
+	for _, options := range []Options{
+		{Connections: 1, Duration: time.Second},
+		{URL: server.URL, Duration: time.Second},
+		{URL: server.URL, Connections: 1},
+		{URL: server.URL, Connections: 1, Duration: -time.Second},
+	} {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", options)
+		}
+	}
+}
+
+func TestBenchProtocols(t *testing.T) {
+	plain := httptest.NewServer(h2c.NewHandler(testload_server.NewServer(testload_server.Options{}), &http2.Server{}))
+	t.Cleanup(plain.Close)
+	secure := httptest.NewUnstartedServer(testload_server.NewServer(testload_server.Options{}))
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	t.Cleanup(secure.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %s", err)
+	}
+	quicServer := &http3.Server{Handler: testload_server.NewServer(testload_server.Options{}), TLSConfig: http3.ConfigureTLSConfig(secure.TLS.Clone())}
+	go quicServer.Serve(conn)
+	t.Cleanup(func() { quicServer.Close() })
+
+	tests := []struct {
+		url      string
+		protocol string
+		expected string
+	}{
+		{plain.URL, ProtocolAuto, "HTTP/1.1"},
+		{plain.URL, ProtocolHTTP2, "HTTP/2.0"},
+		{secure.URL, ProtocolAuto, "HTTP/2.0"},
+		{secure.URL, ProtocolHTTP1, "HTTP/1.1"},
+		{secure.URL, ProtocolHTTP2, "HTTP/2.0"},
+		{"https://" + conn.LocalAddr().String(), ProtocolHTTP3, "HTTP/3.0"},
+	}
+	for _, test := range tests {
+		results, err := Bench(context.Background(), Options{URL: test.url + "/load/64KiB", Connections: 1, TotalSize: 256 * 1024, Protocol: test.protocol, Insecure: true})
+		if err != nil {
+			t.Errorf("Benchmark of %s with %s failed: %s", test.url, test.protocol, err)
+			continue
+		}
+		if len(results.Protocols) != 1 || results.Protocols[test.expected] == 0 {
+			t.Errorf("Expected %s for %s with %s but got %v", test.expected, test.url, test.protocol, results.Protocols)
+		}
+		if util.GetMinFloat64(results.TTFBs) <= 0 {
+			t.Errorf("Expected TTFBs over %s but got %v", test.expected, results.TTFBs)
+		}
+	}
+
+	options := Options{URL: plain.URL, Connections: 1, Duration: time.Second, Protocol: "spdy"}
+	if err := options.Validate(); err == nil {
+		t.Errorf("Expected protocol spdy to be invalid")
+	}
+}
+
+func TestMessagesWebSocket(t *testing.T) {
+	server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?rate=20"
+	results, err := Messages(context.Background(), MessageOptions{URL: url, Connections: 5, Duration: 300 * time.Millisecond, Rate: 20, Size: 128})
+	if err != nil {
+		t.Fatalf("Message test failed: %s", err)
+	}
+	if results.Connected != 5 || len(results.ConnectTimes) != 5 || results.Dropped() != 0 {
+		t.Errorf("Expected 5 connections that lasted but got %d with %d dropped", results.Connected, results.Dropped())
+	}
+	// each connection sends and receives about 6 messages in 300ms
+	if len(results.RoundTrips) < 20 || len(results.Delays) < 20 || results.Messages != len(results.RoundTrips)+len(results.Delays) {
+		t.Errorf("Expected echoes and pushed messages but got %d round trips and %d delays of %d messages", len(results.RoundTrips), len(results.Delays), results.Messages)
+	}
+	if util.GetMinFloat64(results.RoundTrips) <= 0 || util.GetMinFloat64(results.Delays) != 0 {
+		t.Errorf("Expected positive round trips and delays relative to the fastest message")
+	}
+}
+
+func TestMessagesSSE(t *testing.T) {
+	server := newTestServer(t)
+	results, err := Messages(context.Background(), MessageOptions{URL: server.URL + "/sse?rate=10", Connections: 3, Duration: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Message test failed: %s", err)
+	}
+	if results.Connected != 3 || results.Messages < 9 || len(results.Delays) != results.Messages {
+		t.Errorf("Expected about 3 events on each of 3 connections but got %d on %d", results.Messages, results.Connected)
+	}
+
+	// connections closed by the server before the end are dropped
+	results, err = Messages(context.Background(), MessageOptions{URL: server.URL + "/sse?duration=100ms", Connections: 2, Duration: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Message test failed: %s", err)
+	}
+	if results.Dropped() != 2 || results.Lifetimes[0] < 0.1 || results.Lifetimes[0] > 0.3 {
+		t.Errorf("Expected 2 connections dropped after 100ms but got %v", results.Lifetimes)
+	}
+
+	for _, options := range []MessageOptions{
+		{URL: "ftp://localhost/sse", Connections: 1, Duration: time.Second},
+		{URL: server.URL + "/sse", Connections: 1, Duration: time.Second, Rate: 1},
+		{URL: server.URL + "/sse", Connections: 0, Duration: time.Second},
+	} {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", options)
+		}
+	}
+}
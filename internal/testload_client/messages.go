@@ -0,0 +1,305 @@
+package testload_client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MessageOptions configures a message test against /ws or /sse. The scheme
+// of the URL selects WebSocket (ws, wss) or server-sent events (http, https).
+type MessageOptions struct {
+	URL         string
+	Connections int
+	Duration    time.Duration
+	// Rate is the number of messages per second each WebSocket connection
+	// sends to be echoed, zero only receives
+	Rate float64
+	// Size of the sent messages in bytes
+	Size     int
+	Insecure bool
+}
+
+func (o *MessageOptions) Validate() error {
+	parsed, err := url.Parse(o.URL)
+	if err != nil || o.URL == "" {
+		return fmt.Errorf("invalid url '%s'", o.URL)
+	}
+	switch parsed.Scheme {
+	case "ws", "wss":
+	case "http", "https":
+		if o.Rate > 0 {
+			return errors.New("server-sent events can not be echoed, use a ws or wss url to send messages")
+		}
+	default:
+		return fmt.Errorf("scheme '%s' not supported, use ws or wss for WebSocket and http or https for server-sent events", parsed.Scheme)
+	}
+	if o.Connections < 1 {
+		return fmt.Errorf("connections must be at least 1, got %d", o.Connections)
+	}
+	if o.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	if o.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %f", o.Rate)
+	}
+	return nil
+}
+
+// MessageResults of a message test. Latencies are in milliseconds.
+type MessageResults struct {
+	Elapsed time.Duration
+	// Connected counts the connections that were established
+	Connected int
+	// ConnectTimes are the times until the connections were established
+	ConnectTimes []float64
+	Messages     int
+	Bytes        int64
+	// RoundTrips are the times until sent messages were echoed
+	RoundTrips []float64
+	// Delays are the transit times of pushed messages minus the shortest
+	// transit time of their connection. This removes the offset between
+	// the clocks of client and server, and shows the delay added by
+	// buffering on the way.
+	Delays []float64
+	// Lifetimes are the seconds connections lasted that were closed before
+	// the end of the test, e.g. by an idle timeout
+	Lifetimes []float64
+	Errors    map[string]int
+}
+
+// Dropped is the number of connections that were closed before the end.
+func (r *MessageResults) Dropped() int {
+	return len(r.Lifetimes)
+}
+
+// ErrorCount is the number of connections that failed to connect.
+func (r *MessageResults) ErrorCount() int {
+	count := 0
+	for _, errors := range r.Errors {
+		count += errors
+	}
+	return count
+}
+
+// connectionResults are collected by a connection and merged at its end.
+type connectionResults struct {
+	connectTime time.Duration
+	messages    int
+	bytes       int64
+	roundTrips  []float64
+	transits    []time.Duration
+	// dropped is when the connection was closed before the end
+	dropped time.Duration
+}
+
+func (c *connectionResults) receive(data []byte, now time.Time) {
+	c.messages++
+	c.bytes += int64(len(data))
+	origin, timestamp, ok := parseMessage(data)
+	if !ok {
+		return
+	}
+	transit := now.Sub(time.Unix(0, timestamp))
+	if origin == "c" {
+		c.roundTrips = append(c.roundTrips, milliseconds(transit))
+	} else {
+		c.transits = append(c.transits, transit)
+	}
+}
+
+// parseMessage reads the origin and timestamp of a message formatted as
+// "<origin> <sequence> <unix nanoseconds> <padding>".
+func parseMessage(data []byte) (string, int64, bool) {
+	fields := strings.SplitN(string(data), " ", 4)
+	if len(fields) < 3 {
+		return "", 0, false
+	}
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return fields[0], timestamp, true
+}
+
+func formatMessage(sequence int64, size int) []byte {
+	header := fmt.Sprintf("c %d %d ", sequence, time.Now().UnixNano())
+	if len(header) >= size {
+		return []byte(header)
+	}
+	return []byte(header + strings.Repeat("x", size-len(header)))
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+// Messages opens options.Connections connections at once and keeps them
+// open for options.Duration.
+func Messages(ctx context.Context, options MessageOptions) (*MessageResults, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithTimeout(ctx, options.Duration)
+	defer stop()
+	connect := connectSSE
+	if strings.HasPrefix(options.URL, "ws") {
+		connect = connectWebSocket
+	}
+
+	results := &MessageResults{Errors: make(map[string]int)}
+	mutex := sync.Mutex{}
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < options.Connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			connection, err := connect(ctx, options)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				if ctx.Err() == nil {
+					results.Errors[err.Error()]++
+				}
+				return
+			}
+			results.merge(connection)
+		}()
+	}
+	wg.Wait()
+	results.Elapsed = time.Since(start)
+
+	if results.Connected == 0 && len(results.Errors) > 0 {
+		return results, fmt.Errorf("all connections failed, e.g. with %s", firstError(results.Errors))
+	}
+	return results, nil
+}
+
+func (r *MessageResults) merge(connection *connectionResults) {
+	r.Connected++
+	r.ConnectTimes = append(r.ConnectTimes, milliseconds(connection.connectTime))
+	r.Messages += connection.messages
+	r.Bytes += connection.bytes
+	r.RoundTrips = append(r.RoundTrips, connection.roundTrips...)
+	if len(connection.transits) > 0 {
+		shortest := connection.transits[0]
+		for _, transit := range connection.transits {
+			shortest = min(shortest, transit)
+		}
+		for _, transit := range connection.transits {
+			r.Delays = append(r.Delays, milliseconds(transit-shortest))
+		}
+	}
+	if connection.dropped > 0 {
+		r.Lifetimes = append(r.Lifetimes, connection.dropped.Seconds())
+	}
+}
+
+// connectWebSocket sends messages at options.Rate and receives echoes and
+// pushed messages until ctx is done.
+func connectWebSocket(ctx context.Context, options MessageOptions) (*connectionResults, error) {
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: 30 * time.Second,
+		TLSClientConfig:  &tls.Config{InsecureSkipVerify: options.Insecure},
+	}
+	start := time.Now()
+	conn, _, err := dialer.DialContext(ctx, options.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	connected := time.Now()
+	results := &connectionResults{connectTime: connected.Sub(start)}
+
+	// the end of the test closes the connection and thereby the read loop
+	writeMutex := sync.Mutex{}
+	stop := context.AfterFunc(ctx, func() {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		conn.Close()
+	})
+	defer stop()
+
+	if options.Rate > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+			defer ticker.Stop()
+			for sequence := int64(0); ; sequence++ {
+				writeMutex.Lock()
+				err := conn.WriteMessage(websocket.TextMessage, formatMessage(sequence, options.Size))
+				writeMutex.Unlock()
+				if err != nil {
+					return
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		results.receive(data, time.Now())
+	}
+	if ctx.Err() == nil {
+		results.dropped = time.Since(connected)
+	}
+	return results, nil
+}
+
+// connectSSE receives server-sent events until ctx is done.
+func connectSSE(ctx context.Context, options MessageOptions) (*connectionResults, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, options.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: options.Insecure}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", response.Status)
+	}
+	connected := time.Now()
+	results := &connectionResults{connectTime: connected.Sub(start)}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 17*1024*1024)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			results.receive([]byte(data), time.Now())
+		}
+	}
+	if ctx.Err() == nil {
+		results.dropped = time.Since(connected)
+	}
+	return results, nil
+}
@@ -0,0 +1,49 @@
+package testload_client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// transport is a round tripper of its own per connection, so that every
+// connection of a benchmark opens its own TCP or QUIC connection.
+type transport struct {
+	http.RoundTripper
+	close func()
+}
+
+// newTransport returns a transport for options.Protocol. Compression is
+// disabled for all of them, since it would distort the transferred bytes.
+func newTransport(options Options) *transport {
+	tlsConfig := &tls.Config{InsecureSkipVerify: options.Insecure}
+	switch options.Protocol {
+	case ProtocolHTTP2:
+		h2 := &http2.Transport{TLSClientConfig: tlsConfig, DisableCompression: true}
+		if strings.HasPrefix(options.URL, "http://") {
+			// h2c with prior knowledge
+			h2.AllowHTTP = true
+			h2.DialTLSContext = func(ctx context.Context, network string, address string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			}
+		}
+		return &transport{RoundTripper: h2, close: h2.CloseIdleConnections}
+	case ProtocolHTTP3:
+		h3 := &http3.RoundTripper{TLSClientConfig: tlsConfig, DisableCompression: true}
+		return &transport{RoundTripper: h3, close: func() { h3.Close() }}
+	default:
+		h1 := http.DefaultTransport.(*http.Transport).Clone()
+		h1.TLSClientConfig = tlsConfig
+		h1.DisableCompression = true
+		if options.Protocol == ProtocolHTTP1 {
+			h1.ForceAttemptHTTP2 = false
+			h1.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+		return &transport{RoundTripper: h1, close: h1.CloseIdleConnections}
+	}
+}
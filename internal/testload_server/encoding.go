@@ -0,0 +1,146 @@
+package testload_server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoders are the content codings the server can compress responses
+// with, in the order it prefers them if the client accepts several equally.
+var encoders = []struct {
+	name   string
+	writer func(w io.Writer) (io.WriteCloser, error)
+}{
+	{"zstd", func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }},
+	{"br", func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil }},
+	{"gzip", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }},
+}
+
+// parseEncodings reads ?compress=gzip,br,zstd. "auto" offers all of them.
+func parseEncodings(compress string) ([]string, error) {
+	if compress == "" {
+		return nil, nil
+	}
+	offered := make([]string, 0)
+	for _, encoding := range strings.Split(strings.ToLower(compress), ",") {
+		encoding = strings.TrimSpace(encoding)
+		if encoding == "auto" {
+			offered = offered[:0]
+			for _, encoder := range encoders {
+				offered = append(offered, encoder.name)
+			}
+			return offered, nil
+		}
+		if newEncoder(encoding) == nil {
+			return nil, fmt.Errorf("compression '%s' not recognized, use gzip, br, zstd or auto", encoding)
+		}
+		offered = append(offered, encoding)
+	}
+	return offered, nil
+}
+
+func newEncoder(encoding string) func(w io.Writer) (io.WriteCloser, error) {
+	for _, encoder := range encoders {
+		if encoder.name == encoding {
+			return encoder.writer
+		}
+	}
+	return nil
+}
+
+// negotiateEncoding picks the offered encoding with the highest quality in
+// acceptEncoding, on a tie the one offered first. It returns "" if the
+// client accepts none of them.
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, parameters, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(parameters), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range offered {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// serveEncoded compresses the whole content with encoding. The compressed
+// length is not known up front, so the response is always chunked, and
+// range requests are answered with the full content.
+func serveEncoded(w http.ResponseWriter, r *http.Request, encoding string, etag string, content io.Reader) {
+	// the compressed representation needs a validator of its own
+	etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	encoder, err := newEncoder(encoding)(w)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(encoder, content)
+	if err != nil {
+		return
+	}
+	encoder.Close()
+}
+
+// chunkedWriter drops the Content-Length and flushes the headers, which
+// makes the server send the body with chunked transfer encoding.
+type chunkedWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *chunkedWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+	w.Flush()
+}
+
+func (w *chunkedWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *chunkedWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,251 @@
+package testload_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+)
+
+// maxDelay bounds the waits of /delay and /drip so that a typo does not
+// keep a connection open for days.
+const maxDelay = 10 * time.Minute
+
+// The handlers in this file follow httpbin, so that ingress rules and
+// client behaviour can be checked against a testload deployment.
+func (s *Server) registerHTTPBin() {
+	s.mux.HandleFunc("/status/", handleStatus)
+	s.mux.HandleFunc("/redirect/", handleRedirect)
+	s.mux.HandleFunc("/headers", handleHeaders)
+	s.mux.HandleFunc("/delay/", handleDelay)
+	s.mux.HandleFunc("/drip", handleDrip)
+	s.mux.HandleFunc("/cookies", handleCookies)
+	s.mux.HandleFunc("/cookies/set", handleSetCookies)
+	s.mux.HandleFunc("/cookies/delete", handleDeleteCookies)
+	s.mux.HandleFunc("/echo", handleEcho)
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+// handleStatus answers /status/<code> with that code. A list such as
+// /status/200,500,503 picks one of them at random for every request.
+// Informational 1xx codes are rejected, net/http sends them ahead of an
+// implicit 200 or, for 101, as a final response without an upgrade.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	codes := strings.Split(strings.TrimPrefix(r.URL.Path, "/status/"), ",")
+	for _, codeString := range codes {
+		code, err := strconv.Atoi(codeString)
+		if err != nil || code < 200 || code > 599 {
+			http.Error(w, fmt.Sprintf("invalid status code '%s', use 200 to 599", codeString), http.StatusBadRequest)
+			return
+		}
+	}
+	code, _ := strconv.Atoi(codes[rand.Intn(len(codes))])
+	if code >= 300 && code < 400 {
+		w.Header().Set("Location", "/redirect/1")
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="testload"`)
+	}
+	w.WriteHeader(code)
+}
+
+// handleRedirect answers /redirect/<n> with a redirect to /redirect/<n-1>
+// and the last one with a redirect to /headers. ?status= selects the
+// redirect code and ?absolute=true sends absolute locations.
+func handleRedirect(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+	if err != nil || n < 1 || n > 100 {
+		http.Error(w, "the number of redirects must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+	code := http.StatusFound
+	if statusString := r.URL.Query().Get("status"); statusString != "" {
+		code, err = strconv.Atoi(statusString)
+		if err != nil || code < 300 || code > 308 {
+			http.Error(w, fmt.Sprintf("invalid redirect status '%s'", statusString), http.StatusBadRequest)
+			return
+		}
+	}
+
+	location := "/headers"
+	if n > 1 {
+		location = fmt.Sprintf("/redirect/%d", n-1)
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+	}
+	if r.URL.Query().Get("absolute") == "true" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		location = fmt.Sprintf("%s://%s%s", scheme, r.Host, location)
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(code)
+}
+
+// requestHeaders returns the headers of r including Host, which Go keeps
+// apart from the others.
+func requestHeaders(r *http.Request) map[string]string {
+	headers := map[string]string{"Host": r.Host}
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func handleHeaders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"headers": requestHeaders(r)})
+}
+
+// parseDelay reads a Go duration or, like httpbin, a number of seconds.
+func parseDelay(delayString string) (time.Duration, error) {
+	delay, err := util.GetDurationFromString(delayString)
+	if err != nil {
+		seconds, parseErr := strconv.ParseFloat(delayString, 64)
+		if parseErr != nil || seconds < 0 {
+			return 0, err
+		}
+		delay = time.Duration(seconds * float64(time.Second))
+	}
+	if delay > maxDelay {
+		return 0, fmt.Errorf("delay '%s' exceeds the maximum of %s", delayString, maxDelay)
+	}
+	return delay, nil
+}
+
+// handleDelay answers /delay/<duration> after waiting for the duration.
+func handleDelay(w http.ResponseWriter, r *http.Request) {
+	delay, err := parseDelay(strings.TrimPrefix(r.URL.Path, "/delay/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sleep(r.Context(), delay) != nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"delay": delay.String(), "headers": requestHeaders(r)})
+}
+
+// handleDrip sends ?numbytes= bytes spread evenly over ?duration= after
+// ?delay=, answering with ?code=.
+func handleDrip(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	numBytes, duration, delay, code := 10, 2*time.Second, time.Duration(0), http.StatusOK
+	var err error
+	if value := query.Get("numbytes"); value != "" {
+		numBytes, err = strconv.Atoi(value)
+		if err != nil || numBytes < 1 || numBytes > 10*1024*1024 {
+			http.Error(w, "numbytes must be between 1 and 10485760", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, parameter := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"duration", &duration},
+		{"delay", &delay},
+	} {
+		if value := query.Get(parameter.name); value != "" {
+			*parameter.value, err = parseDelay(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %s", parameter.name, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if value := query.Get("code"); value != "" {
+		code, err = strconv.Atoi(value)
+		if err != nil || code < 200 || code > 599 {
+			http.Error(w, fmt.Sprintf("invalid status code '%s'", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sleep(r.Context(), delay) != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(numBytes))
+	w.WriteHeader(code)
+	flusher, _ := w.(http.Flusher)
+	interval := duration / time.Duration(numBytes)
+	for i := 0; i < numBytes; i++ {
+		if i > 0 && sleep(r.Context(), interval) != nil {
+			return
+		}
+		_, err := w.Write([]byte{'*'})
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func requestCookies(r *http.Request) map[string]string {
+	cookies := make(map[string]string)
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	return cookies
+}
+
+func handleCookies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"cookies": requestCookies(r)})
+}
+
+// handleSetCookies sets the cookies of the query, e.g.
+// /cookies/set?session=abc, and redirects to /cookies.
+func handleSetCookies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: query.Get(name), Path: "/"})
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
+
+// handleDeleteCookies expires the cookies named in the query, e.g.
+// /cookies/delete?session, and redirects to /cookies.
+func handleDeleteCookies(w http.ResponseWriter, r *http.Request) {
+	for name := range r.URL.Query() {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Expires: time.Unix(0, 0)})
+	}
+	http.Redirect(w, r, "/cookies", http.StatusFound)
+}
+
+// handleEcho sends the request body back with its content type, so that
+// bodies can be checked for modifications on their way through proxies.
+func handleEcho(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if r.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	}
+	buffer := uploadBuffers.Get().(*[]byte)
+	defer uploadBuffers.Put(buffer)
+	io.CopyBuffer(w, r.Body, *buffer)
+}
@@ -0,0 +1,181 @@
+package testload_server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+)
+
+// maxMessageRate bounds the messages per second pushed on one connection.
+const maxMessageRate = 10000
+
+// messageStream is the push configuration of /ws and /sse.
+type messageStream struct {
+	// rate is in messages per second, zero pushes nothing
+	rate float64
+	size int64
+	// duration ends the stream, zero keeps it open until the client leaves
+	duration time.Duration
+}
+
+// parseMessageStream reads ?rate=<messages per second>&size=<bytes>&duration=<duration>.
+func parseMessageStream(query url.Values, defaultRate float64) (messageStream, error) {
+	stream := messageStream{rate: defaultRate, size: 64}
+	var err error
+	if rateString := query.Get("rate"); rateString != "" {
+		stream.rate, err = strconv.ParseFloat(rateString, 64)
+		if err != nil || stream.rate < 0 || stream.rate > maxMessageRate {
+			return stream, fmt.Errorf("invalid rate '%s', use 0 to %d messages per second", rateString, maxMessageRate)
+		}
+	}
+	if sizeString := query.Get("size"); sizeString != "" {
+		stream.size, err = util.GetByteSizeFromString(sizeString)
+		if err != nil || stream.size > 16*1024*1024 {
+			return stream, fmt.Errorf("invalid size '%s', use up to 16MiB", sizeString)
+		}
+	}
+	if durationString := query.Get("duration"); durationString != "" {
+		stream.duration, err = util.GetDurationFromString(durationString)
+		if err != nil {
+			return stream, err
+		}
+	}
+	return stream, nil
+}
+
+// message formats a pushed message as "s <sequence> <unix nanoseconds> "
+// padded to the size of the stream. Clients measure the delay with the
+// timestamp and the messages they send for echoes start with "c".
+func (s messageStream) message(sequence int64) []byte {
+	header := fmt.Sprintf("s %d %d ", sequence, time.Now().UnixNano())
+	if int64(len(header)) >= s.size {
+		return []byte(header)
+	}
+	return []byte(header + strings.Repeat("x", int(s.size)-len(header)))
+}
+
+// push calls send for every message of the stream until it ends, send
+// fails or done is closed. Without a rate it only waits for the end.
+func (s messageStream) push(done <-chan struct{}, send func([]byte) error) {
+	var end <-chan time.Time
+	if s.duration > 0 {
+		timer := time.NewTimer(s.duration)
+		defer timer.Stop()
+		end = timer.C
+	}
+	if s.rate == 0 {
+		// nothing to push, but the stream still lasts its duration
+		select {
+		case <-end:
+		case <-done:
+		}
+		return
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / s.rate))
+	defer ticker.Stop()
+	for sequence := int64(0); ; sequence++ {
+		if send(s.message(sequence)) != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-end:
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  64 * 1024,
+	WriteBufferSize: 64 * 1024,
+	// load tests come from anywhere
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// handleWebSocket echoes every message on /ws and additionally pushes
+// messages if ?rate= is given.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	stream, err := parseMessageStream(r.URL.Query(), 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has answered the request already
+		return
+	}
+	defer conn.Close()
+	log.Debug().Msgf("WebSocket connection from %s", r.RemoteAddr)
+
+	// echoes and pushed messages are written from different goroutines
+	writeMutex := sync.Mutex{}
+	write := func(messageType int, data []byte) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return conn.WriteMessage(messageType, data)
+	}
+
+	done := make(chan struct{})
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		stream.push(done, func(message []byte) error { return write(websocket.TextMessage, message) })
+		if stream.duration > 0 {
+			write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "duration reached"))
+		}
+	}()
+	defer func() {
+		close(done)
+		<-pushed
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		err = write(messageType, data)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleSSE pushes messages as server-sent events on /sse, one per second
+// unless ?rate= is given. The event id is the sequence number.
+func handleSSE(w http.ResponseWriter, r *http.Request) {
+	stream, err := parseMessageStream(r.URL.Query(), 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	log.Debug().Msgf("SSE connection from %s", r.RemoteAddr)
+
+	sequence := 0
+	stream.push(r.Context().Done(), func(message []byte) error {
+		_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", sequence, message)
+		sequence++
+		flusher.Flush()
+		return err
+	})
+}
@@ -1,50 +1,200 @@
 package testload_server
 
 import (
-	"crypto/rand"
+	"crypto/tls"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mxcd/go-config/config"
+	"github.com/mxcd/tester-toolbox/internal/payload"
 	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-func StartServer() {
+// Options configures the testload server.
+type Options struct {
+	// LastModified is announced for all generated content. Zero uses the
+	// time the server was created.
+	LastModified time.Time
+}
+
+// Server serves generated content for network performance tests.
+type Server struct {
+	options Options
+	mux     *http.ServeMux
+}
+
+func NewServer(options Options) *Server {
+	if options.LastModified.IsZero() {
+		options.LastModified = time.Now()
+	}
+	// Last-Modified has a resolution of one second
+	options.LastModified = options.LastModified.UTC().Truncate(time.Second)
 
-	http.HandleFunc("/load/", func(w http.ResponseWriter, r *http.Request) {
-		sizeString := strings.TrimPrefix(r.URL.Path, "/load/")
-		log.Info().Msgf("Received http request to send %s of data", sizeString)
+	s := &Server{options: options, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/load/", s.handleLoad)
+	s.mux.HandleFunc("/upload", s.handleUpload)
+	s.mux.HandleFunc("/ws", handleWebSocket)
+	s.mux.HandleFunc("/sse", handleSSE)
+	s.registerHTTPBin()
+	return s
+}
+
+// ServeHTTP reports the negotiated protocol in X-Protocol and, for TLS
+// connections, the TLS version in X-TLS-Version before handling r.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Protocol", r.Proto)
+	if r.TLS != nil {
+		w.Header().Set("X-TLS-Version", tls.VersionName(r.TLS.Version))
+	}
+	s.mux.ServeHTTP(w, r)
+}
 
-		size, err := util.GetByteSizeFromString(sizeString)
+// handleLoad serves /load/<size>?seed=<n>&payload=<mode>. The content is
+// derived from size, seed and payload mode alone, so every byte range of it
+// can be requested again and compared, e.g. to resume a download. Single and
+// multi-range requests are answered with 206 and the validators make the
+// content cacheable and allow conditional requests. The rate, delay, ttfb
+// and jitter parameters shape the response like a slow origin, type,
+// chunked and compress control its headers and encoding.
+func (s *Server) handleLoad(w http.ResponseWriter, r *http.Request) {
+	sizeString := strings.TrimPrefix(r.URL.Path, "/load/")
+	log.Info().Msgf("Received http request to send %s of data", sizeString)
+
+	size, err := util.GetByteSizeFromString(sizeString)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	mode, err := payload.ParseMode(query.Get("payload"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var seed uint64
+	if seedString := query.Get("seed"); seedString != "" {
+		seed, err = strconv.ParseUint(seedString, 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
+			http.Error(w, fmt.Sprintf("invalid seed '%s'", seedString), http.StatusBadRequest)
 			return
 		}
+	}
 
-		// w.Header().Set("Content-Type", "application/octet-stream")
-		buf := make([]byte, 1024)
-		var i int64 = 0
-		for ; i < size; i += int64(len(buf)) {
-			if size-i < int64(len(buf)) {
-				buf = buf[:size-i]
-			}
-			_, err := rand.Read(buf)
-			if err != nil {
-				http.Error(w, "Error generating random data", http.StatusInternalServerError)
-				return
-			}
-			_, err = w.Write(buf)
-			if err != nil {
-				return
-			}
+	shape, err := parseShaping(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	contentType := "application/octet-stream"
+	if typeString := query.Get("type"); typeString != "" {
+		if mediaType, _, err := mime.ParseMediaType(typeString); err != nil || !strings.Contains(mediaType, "/") {
+			http.Error(w, fmt.Sprintf("invalid content type '%s'", typeString), http.StatusBadRequest)
+			return
 		}
-	})
+		contentType = typeString
+	}
+	chunked := false
+	if chunkedString := query.Get("chunked"); chunkedString != "" {
+		chunked, err = strconv.ParseBool(chunkedString)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid chunked '%s'", chunkedString), http.StatusBadRequest)
+			return
+		}
+	}
+	encodings, err := parseEncodings(query.Get("compress"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if chunked {
+		w = &chunkedWriter{ResponseWriter: w}
+	}
+	if shape.enabled() {
+		w, err = shape.writer(w, r)
+		if err != nil {
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Last-Modified", s.options.LastModified.Format(http.TimeFormat))
+	etag := loadETag(mode, seed, size)
+	content := payload.NewReader(mode, seed, size)
+	if len(encodings) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings); encoding != "" {
+			serveEncoded(w, r, encoding, etag, content)
+			return
+		}
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", s.options.LastModified, content)
+}
+
+// loadETag is a strong validator, since the same parameters always produce
+// the same bytes.
+func loadETag(mode payload.Mode, seed uint64, size int64) string {
+	return fmt.Sprintf(`"%s-%d-%d"`, mode, seed, size)
+}
+
+// StartServer serves HTTP/1.1 and h2c on PORT and, if TLS_PORT is set,
+// HTTP/1.1 and h2 over TLS on TLS_PORT as well as HTTP/3 on the same UDP
+// port if HTTP3 is enabled.
+func StartServer() {
+	handler := NewServer(Options{})
+	errs := make(chan error)
 
 	port := config.Get().Int("PORT")
-	portString := fmt.Sprintf(":%d", port)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler}
+	if config.Get().Bool("H2C") {
+		server.Handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	err := util.ConfigureServerTimeouts(server)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server timeout")
+	}
 	log.Info().Msgf("Starting server on port %d", port)
-	http.ListenAndServe(portString, nil)
+	go func() { errs <- server.ListenAndServe() }()
+
+	if tlsPort := config.Get().Int("TLS_PORT"); tlsPort != 0 {
+		certificate, err := loadCertificate(config.Get().String("TLS_CERT"), config.Get().String("TLS_KEY"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load the TLS certificate")
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}}
+		tlsServer := &http.Server{Addr: fmt.Sprintf(":%d", tlsPort), Handler: handler, TLSConfig: tlsConfig}
+		err = util.ConfigureServerTimeouts(tlsServer)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid server timeout")
+		}
+
+		if config.Get().Bool("HTTP3") {
+			quicServer := &http3.Server{Addr: tlsServer.Addr, Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsConfig.Clone())}
+			tlsServer.Handler = altSvc(handler, quicServer)
+			log.Info().Msgf("Starting HTTP/3 server on UDP port %d", tlsPort)
+			go func() { errs <- quicServer.ListenAndServe() }()
+		}
+		log.Info().Msgf("Starting TLS server on port %d", tlsPort)
+		go func() { errs <- tlsServer.ListenAndServeTLS("", "") }()
+	}
+
+	log.Fatal().Err(<-errs).Msg("Server stopped")
+}
+
+// altSvc announces the HTTP/3 server in the Alt-Svc header, so that clients
+// can switch to it.
+func altSvc(handler http.Handler, quicServer *http3.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quicServer.SetQuicHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	})
 }
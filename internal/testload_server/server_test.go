@@ -0,0 +1,727 @@
+package testload_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mxcd/tester-toolbox/internal/payload"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var lastModified = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(NewServer(Options{LastModified: lastModified}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to read body: %s", err)
+	}
+	return response, body
+}
+
+func expectedContent(mode payload.Mode, seed uint64, size int64) []byte {
+	content, _ := io.ReadAll(payload.NewReader(mode, seed, size))
+	return content
+}
+
+func TestLoad(t *testing.T) {
+	server := newTestServer(t)
+	response, body := get(t, server.URL+"/load/10KiB?seed=7&payload=compressible", nil)
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", response.StatusCode)
+	}
+	if !bytes.Equal(body, expectedContent(payload.ModeCompressible, 7, 10240)) {
+		t.Errorf("Expected the compressible payload with seed 7")
+	}
+	if response.ContentLength != 10240 {
+		t.Errorf("Expected a Content-Length of 10240 but got %d", response.ContentLength)
+	}
+	if response.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected byte ranges to be accepted")
+	}
+	if response.Header.Get("ETag") != `"compressible-7-10240"` {
+		t.Errorf("Unexpected ETag %s", response.Header.Get("ETag"))
+	}
+	if response.Header.Get("Last-Modified") != lastModified.Format(http.TimeFormat) {
+		t.Errorf("Unexpected Last-Modified %s", response.Header.Get("Last-Modified"))
+	}
+
+	_, other := get(t, server.URL+"/load/10KiB?seed=8&payload=compressible", nil)
+	if bytes.Equal(body, other) {
+		t.Errorf("Expected different seeds to produce different content")
+	}
+
+	for _, url := range []string{"/load/ten", "/load/1KiB?seed=-1", "/load/1KiB?payload=text"} {
+		response, _ := get(t, server.URL+url, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", url, response.StatusCode)
+		}
+	}
+}
+
+func TestLoadRange(t *testing.T) {
+	server := newTestServer(t)
+	content := expectedContent(payload.ModeRandom, 3, 100000)
+
+	tests := []struct {
+		header   string
+		from, to int
+	}{
+		{"bytes=0-0", 0, 1},
+		{"bytes=1000-1999", 1000, 2000},
+		{"bytes=99990-", 99990, 100000},
+		{"bytes=-10", 99990, 100000},
+		{"bytes=50000-200000", 50000, 100000},
+	}
+	for _, test := range tests {
+		response, body := get(t, server.URL+"/load/100000?seed=3", http.Header{"Range": {test.header}})
+		if response.StatusCode != http.StatusPartialContent {
+			t.Errorf("Expected status 206 for %s but got %d", test.header, response.StatusCode)
+			continue
+		}
+		if !bytes.Equal(body, content[test.from:test.to]) {
+			t.Errorf("Expected bytes %d to %d for %s", test.from, test.to, test.header)
+		}
+	}
+
+	response, _ := get(t, server.URL+"/load/100000?seed=3", http.Header{"Range": {"bytes=100000-"}})
+	if response.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("Expected status 416 for a range beyond the end but got %d", response.StatusCode)
+	}
+}
+
+func TestLoadMultiRange(t *testing.T) {
+	server := newTestServer(t)
+	content := expectedContent(payload.ModeRandom, 0, 4096)
+
+	response, body := get(t, server.URL+"/load/4KiB", http.Header{"Range": {"bytes=0-9,100-199,4000-"}})
+	if response.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Expected status 206 but got %d", response.StatusCode)
+	}
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected multipart/byteranges but got %s", response.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	expected := [][]byte{content[0:10], content[100:200], content[4000:]}
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Errorf("Expected %d parts but got %d", len(expected), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part %d: %s", i, err)
+		}
+		data, _ := io.ReadAll(part)
+		if i >= len(expected) || !bytes.Equal(data, expected[i]) {
+			t.Errorf("Unexpected content of part %d with range %s", i, part.Header.Get("Content-Range"))
+		}
+	}
+}
+
+func TestLoadConditional(t *testing.T) {
+	server := newTestServer(t)
+	etag := `"random-0-1024"`
+
+	response, _ := get(t, server.URL+"/load/1KiB", http.Header{"If-None-Match": {etag}})
+	if response.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304 for a matching ETag but got %d", response.StatusCode)
+	}
+	response, _ = get(t, server.URL+"/load/1KiB", http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}})
+	if response.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected status 304 for an unmodified resource but got %d", response.StatusCode)
+	}
+
+	// a resumed download only gets the rest if the content did not change
+	response, body := get(t, server.URL+"/load/1KiB", http.Header{"Range": {"bytes=1000-"}, "If-Range": {etag}})
+	if response.StatusCode != http.StatusPartialContent || len(body) != 24 {
+		t.Errorf("Expected the remaining 24 bytes for a matching If-Range but got status %d with %d bytes", response.StatusCode, len(body))
+	}
+	response, body = get(t, server.URL+"/load/1KiB", http.Header{"Range": {"bytes=1000-"}, "If-Range": {`"random-1-1024"`}})
+	if response.StatusCode != http.StatusOK || len(body) != 1024 {
+		t.Errorf("Expected the full content for a stale If-Range but got status %d with %d bytes", response.StatusCode, len(body))
+	}
+}
+
+func upload(t *testing.T, method string, url string, contentType string, body io.Reader) (*http.Response, uploadResult) {
+	request, _ := http.NewRequest(method, url, body)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Upload failed: %s", err)
+	}
+	defer response.Body.Close()
+	result := uploadResult{}
+	if response.StatusCode == http.StatusOK {
+		err = json.NewDecoder(response.Body).Decode(&result)
+		if err != nil {
+			t.Fatalf("Failed to decode upload result: %s", err)
+		}
+	}
+	return response, result
+}
+
+func TestUpload(t *testing.T) {
+	server := newTestServer(t)
+	content := expectedContent(payload.ModeRandom, 1, 3*1024*1024+5)
+	sum := sha256.Sum256(content)
+
+	response, result := upload(t, http.MethodPut, server.URL+"/upload?checksum=sha256", "", bytes.NewReader(content))
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", response.StatusCode)
+	}
+	if result.Bytes != int64(len(content)) || result.ContentLength != int64(len(content)) || result.Chunked {
+		t.Errorf("Expected %d bytes with a Content-Length but got %+v", len(content), result)
+	}
+	if result.Checksum != hex.EncodeToString(sum[:]) || result.Algorithm != "sha256" {
+		t.Errorf("Expected the SHA-256 of the content but got %s %s", result.Algorithm, result.Checksum)
+	}
+	if result.Seconds <= 0 || result.Throughput <= 0 {
+		t.Errorf("Expected a duration and throughput but got %+v", result)
+	}
+
+	// a reader of unknown length is sent chunked
+	response, result = upload(t, http.MethodPost, server.URL+"/upload", "application/octet-stream", io.MultiReader(bytes.NewReader(content)))
+	if response.StatusCode != http.StatusOK || result.Bytes != int64(len(content)) || !result.Chunked || result.ContentLength != -1 {
+		t.Errorf("Expected a chunked upload of %d bytes but got %+v", len(content), result)
+	}
+	if result.Checksum != "" {
+		t.Errorf("Expected no checksum unless requested")
+	}
+
+	response, _ = upload(t, http.MethodGet, server.URL+"/upload", "", nil)
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for GET but got %d", response.StatusCode)
+	}
+	response, _ = upload(t, http.MethodPost, server.URL+"/upload?checksum=sha3", "", bytes.NewReader(content[:10]))
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown checksum but got %d", response.StatusCode)
+	}
+}
+
+func TestUploadMultipart(t *testing.T) {
+	server := newTestServer(t)
+	file := expectedContent(payload.ModeCompressible, 2, 100000)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("description", "test")
+	part, _ := writer.CreateFormFile("file", "data.bin")
+	part.Write(file)
+	writer.Close()
+
+	response, result := upload(t, http.MethodPost, server.URL+"/upload?checksum=crc32", writer.FormDataContentType(), body)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", response.StatusCode)
+	}
+	if len(result.Parts) != 2 || result.Bytes != int64(len("test")+len(file)) {
+		t.Fatalf("Expected two parts with %d bytes but got %+v", len("test")+len(file), result)
+	}
+	uploaded := result.Parts[1]
+	if uploaded.Name != "file" || uploaded.Filename != "data.bin" || uploaded.Bytes != int64(len(file)) {
+		t.Errorf("Unexpected file part %+v", uploaded)
+	}
+	if uploaded.Checksum != fmt.Sprintf("%08x", crc32.ChecksumIEEE(file)) {
+		t.Errorf("Expected the CRC-32 of the file but got %s", uploaded.Checksum)
+	}
+}
+
+func TestLoadShaping(t *testing.T) {
+	server := newTestServer(t)
+
+	start := time.Now()
+	response, body := get(t, server.URL+"/load/200KiB?rate=400KiB/s", nil)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("Expected 200KiB at 400KiB/s to take about 500ms but took %s", elapsed)
+	}
+	if response.StatusCode != http.StatusOK || !bytes.Equal(body, expectedContent(payload.ModeRandom, 0, 200*1024)) {
+		t.Errorf("Expected the shaped response to keep its content")
+	}
+
+	start = time.Now()
+	response, err := http.Get(server.URL + "/load/1KiB?delay=300ms&ttfb=300ms")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	headers := time.Since(start)
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	firstByte := time.Since(start)
+	if headers < 300*time.Millisecond || headers > 550*time.Millisecond {
+		t.Errorf("Expected the headers after the 300ms delay but got them after %s", headers)
+	}
+	if firstByte-headers < 250*time.Millisecond {
+		t.Errorf("Expected the body 300ms after the headers but got it %s after them", firstByte-headers)
+	}
+
+	for _, query := range []string{"rate=fast", "rate=0", "delay=-1s", "ttfb=1", "jitter=soon"} {
+		response, _ := get(t, server.URL+"/load/1KiB?"+query, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", query, response.StatusCode)
+		}
+	}
+}
+
+// BenchmarkLoad measures the throughput of a single connection over loopback.
+func BenchmarkLoad(b *testing.B) {
+	server := httptest.NewServer(NewServer(Options{}))
+	defer server.Close()
+	const size = 256 * 1024 * 1024
+	buffer := make([]byte, 256*1024)
+
+	for _, mode := range []payload.Mode{payload.ModeRandom, payload.ModeCompressible, payload.ModeZero, payload.ModeBlock} {
+		b.Run(string(mode), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				response, err := http.Get(fmt.Sprintf("%s/load/%d?payload=%s", server.URL, size, mode))
+				if err != nil {
+					b.Fatalf("Request failed: %s", err)
+				}
+				n, _ := io.CopyBuffer(io.Discard, struct{ io.Reader }{response.Body}, buffer)
+				response.Body.Close()
+				if n != size {
+					b.Fatalf("Expected %d bytes but got %d", size, n)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadHeaders(t *testing.T) {
+	server := newTestServer(t)
+
+	response, body := get(t, server.URL+"/load/100KiB?type=text/csv%3Bcharset=utf-8&chunked=true", nil)
+	if response.Header.Get("Content-Type") != "text/csv;charset=utf-8" {
+		t.Errorf("Expected the requested content type but got %s", response.Header.Get("Content-Type"))
+	}
+	if response.ContentLength != -1 || len(response.TransferEncoding) == 0 || response.TransferEncoding[0] != "chunked" {
+		t.Errorf("Expected a chunked response without Content-Length but got %d %v", response.ContentLength, response.TransferEncoding)
+	}
+	if len(body) != 100*1024 {
+		t.Errorf("Expected 100KiB but got %d bytes", len(body))
+	}
+
+	// small responses would get a Content-Length from the server
+	response, _ = get(t, server.URL+"/load/10?chunked=true", nil)
+	if response.ContentLength != -1 {
+		t.Errorf("Expected a small response to be chunked too")
+	}
+
+	for _, query := range []string{"type=text", "chunked=maybe", "compress=lz4"} {
+		response, _ := get(t, server.URL+"/load/1KiB?"+query, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", query, response.StatusCode)
+		}
+	}
+}
+
+func TestLoadCompression(t *testing.T) {
+	server := newTestServer(t)
+	content := expectedContent(payload.ModeCompressible, 0, 1024*1024)
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	tests := []struct {
+		compress       string
+		acceptEncoding string
+		expected       string
+	}{
+		{"auto", "gzip, deflate, br;q=0.5", "gzip"},
+		{"auto", "*", "zstd"},
+		{"auto", "zstd;q=0, br", "br"},
+		{"gzip", "zstd, br, gzip;q=0.1", "gzip"},
+		{"br,gzip", "gzip, br", "br"},
+		{"auto", "", ""},
+		{"zstd", "gzip", ""},
+	}
+	for _, test := range tests {
+		response, body := get(t, server.URL+"/load/1MiB?payload=compressible&compress="+test.compress, http.Header{"Accept-Encoding": {test.acceptEncoding}, "Range": {"bytes=0-9"}})
+		encoding := response.Header.Get("Content-Encoding")
+		if encoding != test.expected {
+			t.Errorf("Expected encoding '%s' for %s offering %s but got '%s'", test.expected, test.acceptEncoding, test.compress, encoding)
+			continue
+		}
+		if response.Header.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Expected Vary: Accept-Encoding")
+		}
+		if encoding == "" {
+			if response.StatusCode != http.StatusPartialContent {
+				t.Errorf("Expected uncompressed responses to honour the range")
+			}
+			continue
+		}
+
+		if response.StatusCode != http.StatusOK || response.ContentLength != -1 {
+			t.Errorf("Expected a full chunked response for %s but got status %d with length %d", encoding, response.StatusCode, response.ContentLength)
+		}
+		if len(body) > len(content)/2 {
+			t.Errorf("Expected %s to compress the payload but got %d bytes", encoding, len(body))
+		}
+		reader, err := decoders[encoding](bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %s", encoding, err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(decoded, content) {
+			t.Errorf("Expected the %s response to decode to the payload (%v)", encoding, err)
+		}
+
+		etag := response.Header.Get("ETag")
+		if etag != `"compressible-0-1048576-`+encoding+`"` {
+			t.Errorf("Expected an ETag of the %s representation but got %s", encoding, etag)
+		}
+		response, _ = get(t, server.URL+"/load/1MiB?payload=compressible&compress="+test.compress, http.Header{"Accept-Encoding": {test.acceptEncoding}, "If-None-Match": {etag}})
+		if response.StatusCode != http.StatusNotModified {
+			t.Errorf("Expected status 304 for the ETag of the %s representation but got %d", encoding, response.StatusCode)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	server := newTestServer(t)
+	for path, expected := range map[string]int{"/status/204": 204, "/status/503": 503, "/status/418,418": 418, "/status/99": 400, "/status/100": 400, "/status/101": 400, "/status/200,103": 400, "/status/abc": 400} {
+		response, _ := get(t, server.URL+path, nil)
+		if response.StatusCode != expected {
+			t.Errorf("Expected status %d for %s but got %d", expected, path, response.StatusCode)
+		}
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(server.URL + "/status/301")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	response.Body.Close()
+	if response.Header.Get("Location") != "/redirect/1" {
+		t.Errorf("Expected a Location for status 301 but got '%s'", response.Header.Get("Location"))
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	server := newTestServer(t)
+	var locations []string
+	client := &http.Client{CheckRedirect: func(request *http.Request, via []*http.Request) error {
+		locations = append(locations, request.URL.Path)
+		return nil
+	}}
+	response, err := client.Get(server.URL + "/redirect/3?status=307")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || fmt.Sprint(locations) != "[/redirect/2 /redirect/1 /headers]" {
+		t.Errorf("Expected to end at /headers via two redirects but got %d after %v", response.StatusCode, locations)
+	}
+
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	response, err = client.Get(server.URL + "/redirect/2?absolute=true")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound || response.Header.Get("Location") != server.URL+"/redirect/1?absolute=true" {
+		t.Errorf("Expected an absolute 302 redirect but got %d to %s", response.StatusCode, response.Header.Get("Location"))
+	}
+
+	for _, path := range []string{"/redirect/0", "/redirect/1?status=200"} {
+		response, _ := get(t, server.URL+path, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", path, response.StatusCode)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	server := newTestServer(t)
+	_, body := get(t, server.URL+"/headers", http.Header{"X-Test": {"a", "b"}})
+	var result struct {
+		Headers map[string]string `json:"headers"`
+	}
+	err := json.Unmarshal(body, &result)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %s", body, err)
+	}
+	if result.Headers["X-Test"] != "a, b" || result.Headers["Host"] == "" {
+		t.Errorf("Expected the request headers to be echoed but got %v", result.Headers)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	server := newTestServer(t)
+	for _, path := range []string{"/delay/200ms", "/delay/0.2"} {
+		start := time.Now()
+		response, body := get(t, server.URL+path, nil)
+		if response.StatusCode != http.StatusOK || !bytes.Contains(body, []byte(`"delay":"200ms"`)) {
+			t.Errorf("Expected a delay of 200ms for %s but got %d %s", path, response.StatusCode, body)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("Expected %s to take at least 200ms but took %s", path, elapsed)
+		}
+	}
+	for _, path := range []string{"/delay/forever", "/delay/1h"} {
+		response, _ := get(t, server.URL+path, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", path, response.StatusCode)
+		}
+	}
+}
+
+func TestDrip(t *testing.T) {
+	server := newTestServer(t)
+	start := time.Now()
+	response, body := get(t, server.URL+"/drip?numbytes=5&duration=400ms&delay=100ms&code=202", nil)
+	elapsed := time.Since(start)
+	if response.StatusCode != http.StatusAccepted || string(body) != "*****" {
+		t.Errorf("Expected 5 bytes with status 202 but got %d %q", response.StatusCode, body)
+	}
+	// the first byte is sent right after the delay, the others in intervals of 80ms
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected the drip to take at least 400ms but took %s", elapsed)
+	}
+
+	for _, query := range []string{"numbytes=0", "duration=soon", "code=100"} {
+		response, _ := get(t, server.URL+"/drip?"+query, nil)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s but got %d", query, response.StatusCode)
+		}
+	}
+}
+
+func TestCookies(t *testing.T) {
+	server := newTestServer(t)
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	cookies := func(path string) map[string]string {
+		response, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Request failed: %s", err)
+		}
+		defer response.Body.Close()
+		var result struct {
+			Cookies map[string]string `json:"cookies"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&result)
+		if err != nil {
+			t.Fatalf("Failed to decode the cookies: %s", err)
+		}
+		return result.Cookies
+	}
+
+	if result := cookies("/cookies/set?session=abc&theme=dark"); result["session"] != "abc" || result["theme"] != "dark" {
+		t.Errorf("Expected the cookies to be set but got %v", result)
+	}
+	if result := cookies("/cookies/delete?session"); len(result) != 1 || result["theme"] != "dark" {
+		t.Errorf("Expected only the session cookie to be deleted but got %v", result)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	server := newTestServer(t)
+	content := expectedContent(payload.ModeRandom, 3, 1024*1024)
+	response, err := http.Post(server.URL+"/echo", "application/x-test", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.Header.Get("Content-Type") != "application/x-test" || !bytes.Equal(body, content) {
+		t.Errorf("Expected the body to be echoed with its content type but got %d bytes of %s", len(body), response.Header.Get("Content-Type"))
+	}
+}
+
+func TestProtocols(t *testing.T) {
+	certificate, err := selfSignedCertificate([]string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to generate a certificate: %s", err)
+	}
+	leaf, _ := x509.ParseCertificate(certificate.Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	clientConfig := &tls.Config{RootCAs: roots}
+
+	plain := newTestServer(t)
+	cleartext := httptest.NewServer(h2c.NewHandler(NewServer(Options{}), &http2.Server{}))
+	t.Cleanup(cleartext.Close)
+	secure := httptest.NewUnstartedServer(NewServer(Options{}))
+	secure.EnableHTTP2 = true
+	secure.TLS = tlsConfig
+	secure.StartTLS()
+	t.Cleanup(secure.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %s", err)
+	}
+	quicServer := &http3.Server{Handler: NewServer(Options{}), TLSConfig: http3.ConfigureTLSConfig(tlsConfig)}
+	go quicServer.Serve(conn)
+	t.Cleanup(func() { quicServer.Close() })
+	quicClient := &http3.RoundTripper{TLSClientConfig: clientConfig}
+	t.Cleanup(func() { quicClient.Close() })
+
+	tests := []struct {
+		url        string
+		transport  http.RoundTripper
+		protocol   string
+		tlsVersion string
+	}{
+		{plain.URL, http.DefaultTransport, "HTTP/1.1", ""},
+		{cleartext.URL, &http2.Transport{AllowHTTP: true, DialTLSContext: func(ctx context.Context, network string, address string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		}}, "HTTP/2.0", ""},
+		{secure.URL, &http.Transport{TLSClientConfig: clientConfig, ForceAttemptHTTP2: true}, "HTTP/2.0", "TLS 1.3"},
+		{"https://" + conn.LocalAddr().String(), quicClient, "HTTP/3.0", "TLS 1.3"},
+	}
+	for _, test := range tests {
+		client := &http.Client{Transport: test.transport}
+		response, err := client.Get(test.url + "/load/1KiB")
+		if err != nil {
+			t.Errorf("Request to %s failed: %s", test.url, err)
+			continue
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if len(body) != 1024 {
+			t.Errorf("Expected 1KiB over %s but got %d bytes", test.protocol, len(body))
+		}
+		if response.Header.Get("X-Protocol") != test.protocol || response.Header.Get("X-TLS-Version") != test.tlsVersion {
+			t.Errorf("Expected %s with '%s' but got %s with '%s'", test.protocol, test.tlsVersion, response.Header.Get("X-Protocol"), response.Header.Get("X-TLS-Version"))
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url+"/ws", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer conn.Close()
+	for _, message := range []string{"hello", "c 1 2 padding"} {
+		conn.WriteMessage(websocket.TextMessage, []byte(message))
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != message {
+			t.Errorf("Expected the echo of '%s' but got '%s' (%v)", message, data, err)
+		}
+	}
+
+	push, _, err := websocket.DefaultDialer.Dial(url+"/ws?rate=50&size=100&duration=100ms", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer push.Close()
+	messages := 0
+	for {
+		_, data, err := push.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Errorf("Expected a normal closure after the duration but got %s", err)
+			}
+			break
+		}
+		if len(data) != 100 || !bytes.HasPrefix(data, []byte(fmt.Sprintf("s %d ", messages))) {
+			t.Errorf("Expected message %d of 100 bytes but got '%s'", messages, data)
+		}
+		messages++
+	}
+	// 50 messages per second for 100ms, starting right away
+	if messages < 5 || messages > 7 {
+		t.Errorf("Expected about 6 pushed messages but got %d", messages)
+	}
+
+	// without a rate the connection only echoes until the duration ends
+	idle, _, err := websocket.DefaultDialer.Dial(url+"/ws?duration=100ms", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer idle.Close()
+	start := time.Now()
+	_, _, err = idle.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected a normal closure after the duration but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected the connection to last 100ms but it took %s", elapsed)
+	}
+
+	response, _ := get(t, server.URL+"/ws?rate=fast", nil)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid rate but got %d", response.StatusCode)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	server := newTestServer(t)
+	start := time.Now()
+	response, body := get(t, server.URL+"/sse?rate=20&size=50&duration=200ms", nil)
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected an event stream but got %s", response.Header.Get("Content-Type"))
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the stream to last 200ms but it took %s", elapsed)
+	}
+	events := strings.Split(strings.TrimSuffix(string(body), "\n\n"), "\n\n")
+	if len(events) < 4 || len(events) > 5 {
+		t.Errorf("Expected about 5 events but got %d", len(events))
+	}
+	for i, event := range events {
+		id, data, _ := strings.Cut(event, "\n")
+		if id != fmt.Sprintf("id: %d", i) || len(data) != len("data: ")+50 || !strings.HasPrefix(data, fmt.Sprintf("data: s %d ", i)) {
+			t.Errorf("Expected event %d with 50 bytes of data but got %q", i, event)
+		}
+	}
+
+	start = time.Now()
+	_, body = get(t, server.URL+"/sse?rate=0&duration=100ms", nil)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || len(body) != 0 {
+		t.Errorf("Expected an empty stream of 100ms without a rate but got %d bytes after %s", len(body), elapsed)
+	}
+}
@@ -0,0 +1,154 @@
+package testload_server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+)
+
+// shaping slows a response down to emulate a slow origin.
+type shaping struct {
+	// rate limits the body to bytes per second, zero is unlimited
+	rate int64
+	// delay is waited before the response headers are sent
+	delay time.Duration
+	// ttfb is waited between the response headers and the first body byte
+	ttfb time.Duration
+	// jitter adds a random duration between zero and jitter to delay and ttfb
+	jitter time.Duration
+}
+
+// parseShaping reads ?rate=10MiB/s&delay=200ms&ttfb=1s&jitter=50ms.
+func parseShaping(query url.Values) (shaping, error) {
+	result := shaping{}
+	if rateString := query.Get("rate"); rateString != "" {
+		rate, err := util.GetRateFromString(rateString)
+		if err != nil {
+			return result, err
+		}
+		result.rate = rate
+	}
+	for _, duration := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"delay", &result.delay},
+		{"ttfb", &result.ttfb},
+		{"jitter", &result.jitter},
+	} {
+		if durationString := query.Get(duration.name); durationString != "" {
+			value, err := util.GetDurationFromString(durationString)
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", duration.name, err)
+			}
+			*duration.value = value
+		}
+	}
+	return result, nil
+}
+
+func (s shaping) enabled() bool {
+	return s != shaping{}
+}
+
+func (s shaping) withJitter(duration time.Duration) time.Duration {
+	if s.jitter > 0 {
+		duration += time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	return duration
+}
+
+// writer waits for the delay and returns a writer that applies the time to
+// first byte and the rate to the response.
+func (s shaping) writer(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, error) {
+	err := sleep(r.Context(), s.withJitter(s.delay))
+	if err != nil {
+		return nil, err
+	}
+	shaped := &shapedWriter{ResponseWriter: w, ctx: r.Context(), ttfb: s.withJitter(s.ttfb)}
+	if s.rate > 0 {
+		shaped.throttle = util.NewThrottle(s.rate)
+	}
+	return shaped, nil
+}
+
+// shapedWriter flushes the response headers right away, holds the body back
+// for the time to first byte and then writes it in flushed chunks at the
+// rate of its throttle, so that clients and proxies see a steady trickle.
+type shapedWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	ttfb        time.Duration
+	throttle    *util.Throttle
+	wroteHeader bool
+	wroteBody   bool
+}
+
+func (w *shapedWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+	w.Flush()
+}
+
+func (w *shapedWriter) Write(p []byte) (int, error) {
+	if !w.wroteBody {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		w.wroteBody = true
+		err := sleep(w.ctx, w.ttfb)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.throttle == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		w.throttle.Start()
+		chunk := p
+		if size := w.throttle.ChunkSize(); len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		w.Flush()
+		err = sleep(w.ctx, w.throttle.Transferred(n))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *shapedWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// sleep waits for duration unless the request is cancelled before.
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,158 @@
+package testload_server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// uploadResult is the response to an upload.
+type uploadResult struct {
+	Bytes int64 `json:"bytes"`
+	// ContentLength is the announced length, -1 for chunked bodies
+	ContentLength int64   `json:"contentLength"`
+	Chunked       bool    `json:"chunked"`
+	Seconds       float64 `json:"seconds"`
+	// Throughput is in bytes per second
+	Throughput float64        `json:"throughput"`
+	Algorithm  string         `json:"algorithm,omitempty"`
+	Checksum   string         `json:"checksum,omitempty"`
+	Parts      []uploadedPart `json:"parts,omitempty"`
+}
+
+// uploadedPart is a part of a multipart/form-data upload.
+type uploadedPart struct {
+	Name     string `json:"name"`
+	Filename string `json:"filename,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+var uploadBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 64*1024)
+		return &buffer
+	},
+}
+
+// newChecksum returns the hash of ?checksum=, or nil if none is requested.
+func newChecksum(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "":
+		return nil, nil
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "crc32":
+		return crc32.NewIEEE(), nil
+	default:
+		return nil, fmt.Errorf("checksum '%s' not recognized, use md5, sha1, sha256 or crc32", algorithm)
+	}
+}
+
+// discard reads body to its end, feeding it into checksum if there is one.
+func discard(body io.Reader, checksum hash.Hash) (int64, error) {
+	buffer := uploadBuffers.Get().(*[]byte)
+	defer uploadBuffers.Put(buffer)
+	writer := io.Discard
+	if checksum != nil {
+		writer = checksum
+	}
+	// io.Discard reads into its own pooled buffer, the hashes use this one
+	return io.CopyBuffer(writer, body, *buffer)
+}
+
+// handleUpload consumes POST and PUT bodies of /upload and answers with
+// what arrived and how fast. Raw and chunked bodies are counted as a whole,
+// multipart/form-data bodies additionally per part. ?checksum=<algorithm>
+// adds a checksum of the body or of every part.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	algorithm := strings.ToLower(r.URL.Query().Get("checksum"))
+	if _, err := newChecksum(algorithm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Info().Msgf("Received http upload of %d bytes", r.ContentLength)
+
+	start := time.Now()
+	result := &uploadResult{
+		ContentLength: r.ContentLength,
+		Chunked:       len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked",
+		Algorithm:     algorithm,
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = s.readMultipart(r, result)
+	} else {
+		checksum, _ := newChecksum(algorithm)
+		result.Bytes, err = discard(r.Body, checksum)
+		if checksum != nil {
+			result.Checksum = hex.EncodeToString(checksum.Sum(nil))
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msgf("Upload failed after %d bytes", result.Bytes)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	elapsed := time.Since(start)
+	result.Seconds = elapsed.Seconds()
+	if elapsed > 0 {
+		result.Throughput = float64(result.Bytes) / elapsed.Seconds()
+	}
+	log.Info().Msgf("Received %d bytes in %s", result.Bytes, elapsed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) readMultipart(r *http.Request, result *uploadResult) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		checksum, _ := newChecksum(result.Algorithm)
+		uploaded := uploadedPart{Name: part.FormName(), Filename: part.FileName()}
+		uploaded.Bytes, err = discard(part, checksum)
+		result.Bytes += uploaded.Bytes
+		if err != nil {
+			return err
+		}
+		if checksum != nil {
+			uploaded.Checksum = hex.EncodeToString(checksum.Sum(nil))
+		}
+		result.Parts = append(result.Parts, uploaded)
+	}
+}
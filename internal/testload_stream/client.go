@@ -0,0 +1,308 @@
+package testload_stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+)
+
+// TCPOptions configures a TCP test.
+type TCPOptions struct {
+	Address  string
+	Streams  int
+	Duration time.Duration
+	// Reverse makes the server send and the client receive
+	Reverse bool
+}
+
+func (o *TCPOptions) Validate() error {
+	if o.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	if o.Streams < 1 {
+		return fmt.Errorf("streams must be at least 1, got %d", o.Streams)
+	}
+	if o.Duration <= 0 || o.Duration > maxTestDuration {
+		return fmt.Errorf("duration must be between 0 and %s, got %s", maxTestDuration, o.Duration)
+	}
+	return nil
+}
+
+// TCPStream is the result of one TCP connection.
+type TCPStream struct {
+	// Sent are the bytes written by the sender
+	Sent int64
+	// Received are the bytes that arrived at the receiver, the goodput
+	Received int64
+	// Elapsed is the time the receiver took from the first to the last byte
+	Elapsed time.Duration
+	// Retransmits are the segments the sender retransmitted, -1 if unknown
+	Retransmits int64
+	Error       error
+}
+
+// Throughput is the goodput in bytes per second.
+func (s *TCPStream) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Received) / s.Elapsed.Seconds()
+}
+
+// TCPResults of a TCP test.
+type TCPResults struct {
+	Elapsed time.Duration
+	Streams []TCPStream
+}
+
+// Received are the bytes that arrived over all streams.
+func (r *TCPResults) Received() int64 {
+	var bytes int64
+	for _, stream := range r.Streams {
+		bytes += stream.Received
+	}
+	return bytes
+}
+
+// Throughput is the sum of the goodputs of the streams in bytes per second.
+func (r *TCPResults) Throughput() float64 {
+	throughput := 0.0
+	for i := range r.Streams {
+		throughput += r.Streams[i].Throughput()
+	}
+	return throughput
+}
+
+// Retransmits are the segments retransmitted over all streams, -1 if the
+// sender does not report them.
+func (r *TCPResults) Retransmits() int64 {
+	var retransmits int64
+	for _, stream := range r.Streams {
+		if stream.Retransmits < 0 {
+			return -1
+		}
+		retransmits += stream.Retransmits
+	}
+	return retransmits
+}
+
+// TCP runs a TCP test with options.Streams parallel connections.
+func TCP(ctx context.Context, options TCPOptions) (*TCPResults, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+	results := &TCPResults{Streams: make([]TCPStream, options.Streams)}
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := range results.Streams {
+		wg.Add(1)
+		go func(stream *TCPStream) {
+			defer wg.Done()
+			*stream = tcpStream(ctx, options)
+		}(&results.Streams[i])
+	}
+	wg.Wait()
+	results.Elapsed = time.Since(start)
+
+	for _, stream := range results.Streams {
+		if stream.Error != nil {
+			return results, stream.Error
+		}
+	}
+	return results, nil
+}
+
+func tcpStream(ctx context.Context, options TCPOptions) TCPStream {
+	stream := TCPStream{Retransmits: -1}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", options.Address)
+	if err != nil {
+		stream.Error = err
+		return stream
+	}
+	defer conn.Close()
+	// closing the connection ends the test early
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReaderSize(conn, frameSize)
+	writer := bufio.NewWriterSize(conn, frameSize)
+	err = writeLine(writer, tcpRequest{Reverse: options.Reverse, Duration: options.Duration})
+	if err != nil {
+		stream.Error = err
+		return stream
+	}
+
+	report := tcpReport{}
+	if options.Reverse {
+		stream.Received, stream.Elapsed, err = receiveFrames(reader)
+		if err == nil {
+			err = readLine(reader, &report)
+		}
+		stream.Sent = report.Bytes
+		if report.Retransmits != nil {
+			stream.Retransmits = int64(*report.Retransmits)
+		}
+	} else {
+		stream.Sent, err = sendFrames(writer, time.Now().Add(options.Duration))
+		if err == nil {
+			err = readLine(reader, &report)
+		}
+		stream.Received = report.Bytes
+		stream.Elapsed = time.Duration(report.Seconds * float64(time.Second))
+		if retransmits, ok := util.TCPRetransmits(conn); ok {
+			stream.Retransmits = int64(retransmits)
+		}
+	}
+	if err == nil && report.Error != "" {
+		err = errors.New(report.Error)
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	stream.Error = err
+	return stream
+}
+
+// UDPOptions configures a UDP test.
+type UDPOptions struct {
+	Address  string
+	Duration time.Duration
+	// Rate is the send rate in bytes per second
+	Rate int64
+	// Size is the size of the datagrams
+	Size int
+}
+
+func (o *UDPOptions) Validate() error {
+	if o.Address == "" {
+		return errors.New("address must not be empty")
+	}
+	if o.Duration <= 0 || o.Duration > maxTestDuration {
+		return fmt.Errorf("duration must be between 0 and %s, got %s", maxTestDuration, o.Duration)
+	}
+	if o.Rate < 1 {
+		return fmt.Errorf("rate must be at least 1 byte per second, got %d", o.Rate)
+	}
+	if o.Size < datagramHeaderSize || o.Size > MaxDatagramSize {
+		return fmt.Errorf("size must be between %d and %d bytes, got %d", datagramHeaderSize, MaxDatagramSize, o.Size)
+	}
+	return nil
+}
+
+// UDPResults of a UDP test.
+type UDPResults struct {
+	Elapsed     time.Duration
+	SentPackets int64
+	SentBytes   int64
+	// Received, Lost, OutOfOrder and Jitter are reported by the server
+	ReceivedPackets int64
+	ReceivedBytes   int64
+	// ReceiveElapsed is the time from the first to the last received datagram
+	ReceiveElapsed time.Duration
+	Lost           int64
+	OutOfOrder     int64
+	Jitter         time.Duration
+}
+
+// Throughput is the received bytes per second.
+func (r *UDPResults) Throughput() float64 {
+	if r.ReceiveElapsed <= 0 {
+		return 0
+	}
+	return float64(r.ReceivedBytes) / r.ReceiveElapsed.Seconds()
+}
+
+// LossPercent is the share of lost datagrams in percent.
+func (r *UDPResults) LossPercent() float64 {
+	if r.SentPackets == 0 {
+		return 0
+	}
+	return float64(r.Lost) / float64(r.SentPackets) * 100
+}
+
+const (
+	// reportAttempts is how often the end datagram is sent while waiting
+	// for the report
+	reportAttempts = 5
+	reportTimeout  = 500 * time.Millisecond
+)
+
+// UDP sends datagrams at options.Rate for options.Duration and fetches
+// the report of the server.
+func UDP(ctx context.Context, options UDPOptions) (*UDPResults, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", options.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	session := rand.Uint64()
+	buffer := make([]byte, options.Size)
+	copy(buffer[datagramHeaderSize:], frameData)
+	throttle := util.NewThrottle(options.Rate)
+	results := &UDPResults{}
+	start := time.Now()
+	deadline := start.Add(options.Duration)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		datagram{session: session, sequence: uint64(results.SentPackets), value: uint64(time.Now().UnixNano())}.encode(buffer)
+		// a datagram refused by the network is lost like any other
+		conn.Write(buffer)
+		results.SentPackets++
+		results.SentBytes += int64(len(buffer))
+		if wait := throttle.Transferred(len(buffer)); wait > time.Millisecond {
+			time.Sleep(wait)
+		}
+	}
+	results.Elapsed = time.Since(start)
+
+	report, err := fetchReport(conn, session, uint64(results.SentPackets))
+	if err != nil {
+		return results, err
+	}
+	results.ReceivedPackets = report.Packets
+	results.ReceivedBytes = report.Bytes
+	results.ReceiveElapsed = time.Duration(report.Seconds * float64(time.Second))
+	results.Lost = report.Lost
+	results.OutOfOrder = report.OutOfOrder
+	results.Jitter = time.Duration(report.JitterMs * float64(time.Millisecond))
+	return results, nil
+}
+
+// fetchReport sends the end datagram until the server answers with its report.
+func fetchReport(conn net.Conn, session uint64, sent uint64) (*udpReport, error) {
+	end := make([]byte, datagramHeaderSize)
+	datagram{session: session, sequence: endSequence, value: sent}.encode(end)
+	answer := make([]byte, MaxDatagramSize)
+	var err error
+	for attempt := 0; attempt < reportAttempts; attempt++ {
+		_, err = conn.Write(end)
+		if err != nil {
+			continue
+		}
+		conn.SetReadDeadline(time.Now().Add(reportTimeout))
+		var n int
+		n, err = conn.Read(answer)
+		if err != nil {
+			continue
+		}
+		report := &udpReport{}
+		err = readLine(bufio.NewReader(bytes.NewReader(answer[:n])), report)
+		if err == nil {
+			return report, nil
+		}
+	}
+	return nil, fmt.Errorf("no report from the server after %d attempts: %w", reportAttempts, err)
+}
@@ -0,0 +1,215 @@
+package testload_stream
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/util"
+	"github.com/rs/zerolog/log"
+)
+
+// maxTestDuration bounds the duration a client may request the server to
+// send for.
+const maxTestDuration = time.Hour
+
+// tcpReadTimeout bounds how long a TCP test may send to the server, so that
+// clients that stall or never end their stream do not hold a connection
+// forever.
+var tcpReadTimeout = maxTestDuration + time.Minute
+
+func ListenAndServeTCP(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Starting TCP stream server on %s", address)
+	return ServeTCP(listener)
+}
+
+// ServeTCP handles TCP tests on listener until it is closed.
+func ServeTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := handleTCP(conn)
+			if err != nil {
+				log.Warn().Err(err).Msgf("TCP test from %s failed", conn.RemoteAddr())
+			}
+		}()
+	}
+}
+
+func handleTCP(conn net.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(tcpReadTimeout))
+	reader := bufio.NewReaderSize(conn, frameSize)
+	writer := bufio.NewWriterSize(conn, frameSize)
+	request := tcpRequest{}
+	err := readLine(reader, &request)
+	if err != nil {
+		return err
+	}
+
+	if !request.Reverse {
+		log.Info().Msgf("Receiving TCP stream from %s", conn.RemoteAddr())
+		bytes, elapsed, err := receiveFrames(reader)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Received %s in %s from %s", util.GetStringFromByteSize(bytes), elapsed, conn.RemoteAddr())
+		return writeLine(writer, tcpReport{Bytes: bytes, Seconds: elapsed.Seconds()})
+	}
+
+	if request.Duration <= 0 || request.Duration > maxTestDuration {
+		return writeLine(writer, tcpReport{Error: "the duration must be between 0 and " + maxTestDuration.String()})
+	}
+	log.Info().Msgf("Sending TCP stream to %s for %s", conn.RemoteAddr(), request.Duration)
+	start := time.Now()
+	bytes, err := sendFrames(writer, start.Add(request.Duration))
+	if err != nil {
+		return err
+	}
+	report := tcpReport{Bytes: bytes, Seconds: time.Since(start).Seconds()}
+	if retransmits, ok := util.TCPRetransmits(conn); ok {
+		report.Retransmits = &retransmits
+	}
+	return writeLine(writer, report)
+}
+
+func ListenAndServeUDP(address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("Starting UDP stream server on %s", address)
+	return ServeUDP(conn)
+}
+
+// sessionTimeout is how long an idle UDP session is kept, e.g. to answer
+// repeated end datagrams.
+const sessionTimeout = time.Minute
+
+// udpSession is the state of a UDP test on the server.
+type udpSession struct {
+	first        time.Time
+	last         time.Time
+	packets      int64
+	bytes        int64
+	nextSequence uint64
+	outOfOrder   int64
+	// transit and jitter are in nanoseconds
+	transit int64
+	jitter  float64
+	report  *udpReport
+}
+
+func (s *udpSession) add(d datagram, size int, now time.Time) {
+	if s.packets == 0 {
+		s.first = now
+	}
+	s.last = now
+	s.packets++
+	s.bytes += int64(size)
+	if d.sequence < s.nextSequence {
+		s.outOfOrder++
+	} else {
+		s.nextSequence = d.sequence + 1
+	}
+
+	// the clocks of client and server differ, but only the change of the
+	// transit time matters
+	transit := now.UnixNano() - int64(d.value)
+	if s.packets > 1 {
+		difference := float64(transit - s.transit)
+		if difference < 0 {
+			difference = -difference
+		}
+		s.jitter += (difference - s.jitter) / 16
+	}
+	s.transit = transit
+}
+
+func (s *udpSession) end(sent uint64) *udpReport {
+	if s.report == nil {
+		lost := int64(sent) - s.packets
+		if lost < 0 {
+			lost = 0
+		}
+		s.report = &udpReport{
+			Packets:    s.packets,
+			Bytes:      s.bytes,
+			Lost:       lost,
+			OutOfOrder: s.outOfOrder,
+			JitterMs:   s.jitter / float64(time.Millisecond),
+		}
+		if s.packets > 0 {
+			s.report.Seconds = s.last.Sub(s.first).Seconds()
+		}
+	}
+	return s.report
+}
+
+// ServeUDP handles UDP tests on conn until it is closed.
+func ServeUDP(conn net.PacketConn) error {
+	sessions := make(map[uint64]*udpSession)
+	lastSweep := time.Now()
+	buffer := make([]byte, MaxDatagramSize)
+	for {
+		n, address, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Warn().Err(err).Msg("Failed to read UDP datagram")
+			continue
+		}
+		now := time.Now()
+		d, err := decodeDatagram(buffer[:n])
+		if err != nil {
+			continue
+		}
+
+		session, ok := sessions[d.session]
+		if !ok {
+			log.Info().Msgf("Receiving UDP stream from %s", address)
+			session = &udpSession{}
+			sessions[d.session] = session
+		}
+		if d.sequence != endSequence {
+			session.add(d, n, now)
+		} else {
+			report := session.end(d.value)
+			session.last = now
+			log.Info().Msgf("Received %d of %d datagrams from %s", report.Packets, d.value, address)
+			writer := bufio.NewWriter(&packetWriter{conn: conn, address: address})
+			err := writeLine(writer, report)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Failed to send UDP report to %s", address)
+			}
+		}
+
+		if now.Sub(lastSweep) > sessionTimeout {
+			for id, session := range sessions {
+				if now.Sub(session.last) > sessionTimeout {
+					delete(sessions, id)
+				}
+			}
+			lastSweep = now
+		}
+	}
+}
+
+// packetWriter sends every write as a datagram to address.
+type packetWriter struct {
+	conn    net.PacketConn
+	address net.Addr
+}
+
+func (w *packetWriter) Write(p []byte) (int, error) {
+	return w.conn.WriteTo(p, w.address)
+}
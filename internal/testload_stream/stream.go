@@ -0,0 +1,171 @@
+// Package testload_stream measures raw TCP and UDP throughput without the
+// overhead of HTTP, similar to iperf.
+//
+// A TCP test starts with a JSON request line from the client. The sender
+// then writes frames of a 4 byte big-endian length followed by as many
+// bytes, and a frame of length 0 ends the data. The other side answers it
+// with a JSON report line.
+//
+// A UDP test consists of datagrams sent from the client to the server. Each
+// datagram starts with a session id, a sequence number and the send time in
+// nanoseconds, all 8 byte big-endian. The datagram with sequence number
+// endSequence carries the number of sent datagrams instead of the time and
+// is answered with a JSON report.
+package testload_stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/mxcd/tester-toolbox/internal/payload"
+)
+
+// frameSize is the size of the TCP data frames.
+const frameSize = 128 * 1024
+
+// frameData is the content of every data frame.
+var frameData = func() []byte {
+	data, _ := io.ReadAll(payload.NewReader(payload.ModeRandom, 0, frameSize))
+	return data
+}()
+
+// tcpRequest starts a TCP test.
+type tcpRequest struct {
+	// Reverse makes the server send for Duration instead of receiving
+	Reverse  bool          `json:"reverse"`
+	Duration time.Duration `json:"duration"`
+}
+
+// tcpReport is sent after the data by the server. As receiver it reports
+// what arrived, as sender what it sent and how many segments the kernel
+// had to retransmit.
+type tcpReport struct {
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+	// Retransmits is missing if the platform of the sender does not expose it
+	Retransmits *uint32 `json:"retransmits,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// sendFrames writes data frames to w until deadline and ends them. It
+// returns the sent bytes without the frame headers.
+func sendFrames(w *bufio.Writer, deadline time.Time) (int64, error) {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, frameSize)
+	var bytes int64
+	for time.Now().Before(deadline) {
+		_, err := w.Write(header)
+		if err != nil {
+			return bytes, err
+		}
+		n, err := w.Write(frameData)
+		bytes += int64(n)
+		if err != nil {
+			return bytes, err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return bytes, err
+	}
+	return bytes, w.Flush()
+}
+
+// receiveFrames reads data frames from r until the end frame. It returns
+// the received bytes without the frame headers and the time from the first
+// to the last byte.
+func receiveFrames(r *bufio.Reader) (int64, time.Duration, error) {
+	header := make([]byte, 4)
+	var bytes int64
+	var start time.Time
+	for {
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			return bytes, time.Since(start), err
+		}
+		if start.IsZero() {
+			start = time.Now()
+		}
+		length := binary.BigEndian.Uint32(header)
+		if length == 0 {
+			return bytes, time.Since(start), nil
+		}
+		if length > frameSize {
+			return bytes, time.Since(start), fmt.Errorf("frame of %d bytes exceeds the maximum of %d", length, frameSize)
+		}
+		n, err := r.Discard(int(length))
+		bytes += int64(n)
+		if err != nil {
+			return bytes, time.Since(start), err
+		}
+	}
+}
+
+func writeLine(w *bufio.Writer, value any) error {
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func readLine(r *bufio.Reader, value any) error {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(line, value)
+}
+
+const (
+	datagramHeaderSize = 24
+	// MaxDatagramSize is the largest UDP payload over IPv4
+	MaxDatagramSize = 65507
+	endSequence     = math.MaxUint64
+)
+
+// datagram is the header of a UDP test datagram.
+type datagram struct {
+	session  uint64
+	sequence uint64
+	// value is the send time in nanoseconds or, in the end datagram, the
+	// number of sent datagrams
+	value uint64
+}
+
+func (d datagram) encode(buffer []byte) {
+	binary.BigEndian.PutUint64(buffer[0:8], d.session)
+	binary.BigEndian.PutUint64(buffer[8:16], d.sequence)
+	binary.BigEndian.PutUint64(buffer[16:24], d.value)
+}
+
+func decodeDatagram(buffer []byte) (datagram, error) {
+	if len(buffer) < datagramHeaderSize {
+		return datagram{}, errors.New("datagram too short")
+	}
+	return datagram{
+		session:  binary.BigEndian.Uint64(buffer[0:8]),
+		sequence: binary.BigEndian.Uint64(buffer[8:16]),
+		value:    binary.BigEndian.Uint64(buffer[16:24]),
+	}, nil
+}
+
+// udpReport is the answer to the end datagram of a UDP test.
+type udpReport struct {
+	Packets int64 `json:"packets"`
+	Bytes   int64 `json:"bytes"`
+	// Seconds is the time from the first to the last datagram
+	Seconds float64 `json:"seconds"`
+	Lost    int64   `json:"lost"`
+	// OutOfOrder counts datagrams that arrived after one with a higher
+	// sequence number
+	OutOfOrder int64 `json:"outOfOrder"`
+	// JitterMs is the interarrival jitter of RFC 3550 in milliseconds
+	JitterMs float64 `json:"jitterMs"`
+}
@@ -0,0 +1,147 @@
+package testload_stream
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func newTCPServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on TCP: %s", err)
+	}
+	go ServeTCP(listener)
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+func newUDPServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %s", err)
+	}
+	go ServeUDP(conn)
+	t.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestTCP(t *testing.T) {
+	address := newTCPServer(t)
+	for _, reverse := range []bool{false, true} {
+		results, err := TCP(context.Background(), TCPOptions{Address: address, Streams: 2, Duration: 200 * time.Millisecond, Reverse: reverse})
+		if err != nil {
+			t.Fatalf("TCP test with reverse %t failed: %s", reverse, err)
+		}
+		for _, stream := range results.Streams {
+			if stream.Received == 0 || stream.Received != stream.Sent {
+				t.Errorf("Expected the sent bytes to arrive with reverse %t but sent %d and received %d", reverse, stream.Sent, stream.Received)
+			}
+			if stream.Elapsed < 100*time.Millisecond || stream.Elapsed > time.Second {
+				t.Errorf("Expected the stream to take about 200ms but it took %s", stream.Elapsed)
+			}
+			if runtime.GOOS == "linux" && stream.Retransmits < 0 {
+				t.Errorf("Expected the retransmits of the sender with reverse %t", reverse)
+			}
+		}
+		if results.Throughput() <= 0 || results.Received() != results.Streams[0].Received+results.Streams[1].Received {
+			t.Errorf("Expected the throughput of both streams")
+		}
+	}
+
+	options := TCPOptions{Address: address, Streams: 1, Duration: 2 * time.Hour}
+	if err := options.Validate(); err == nil {
+		t.Errorf("Expected a duration of 2h to be invalid")
+	}
+}
+
+func TestTCPCancel(t *testing.T) {
+	address := newTCPServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := TCP(ctx, TCPOptions{Address: address, Streams: 1, Duration: 10 * time.Second, Reverse: true})
+	if err == nil {
+		t.Errorf("Expected the canceled test to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the test to stop when canceled but it took %s", elapsed)
+	}
+}
+
+func TestTCPReadTimeout(t *testing.T) {
+	readTimeout := tcpReadTimeout
+	tcpReadTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { tcpReadTimeout = readTimeout })
+	address := newTCPServer(t)
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer conn.Close()
+	// a forward request followed by a stream that never ends
+	_, err = conn.Write([]byte("{\"reverse\":false,\"duration\":1000000000}\n"))
+	if err != nil {
+		t.Fatalf("Failed to send the request: %s", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected the server to close the stalled connection after the read timeout but got %v after %s", err, time.Since(start))
+	}
+}
+
+func TestUDP(t *testing.T) {
+	address := newUDPServer(t)
+	results, err := UDP(context.Background(), UDPOptions{Address: address, Duration: 300 * time.Millisecond, Rate: 1024 * 1024, Size: 1200})
+	if err != nil {
+		t.Fatalf("UDP test failed: %s", err)
+	}
+	// 300ms at 1MiB/s are about 262 datagrams of 1200 bytes
+	if results.SentPackets < 200 || results.SentPackets > 300 {
+		t.Errorf("Expected to send about 262 datagrams but sent %d", results.SentPackets)
+	}
+	if results.ReceivedPackets+results.Lost != results.SentPackets || results.ReceivedBytes != results.ReceivedPackets*1200 {
+		t.Errorf("Expected every datagram to be received or lost but got %+v", results)
+	}
+	if results.LossPercent() > 10 || results.Throughput() <= 0 {
+		t.Errorf("Expected little loss over loopback but got %.1f%% at %.0f B/s", results.LossPercent(), results.Throughput())
+	}
+}
+
+func TestUDPSession(t *testing.T) {
+	session := &udpSession{}
+	start := time.Now()
+	// datagram 2 is lost, 4 arrives late and every transit takes 1ms longer
+	for i, sequence := range []uint64{0, 1, 3, 5, 4} {
+		sent := start.Add(time.Duration(sequence) * 10 * time.Millisecond)
+		session.add(datagram{sequence: sequence, value: uint64(sent.UnixNano())}, 100, sent.Add(time.Duration(i)*time.Millisecond))
+	}
+	report := session.end(6)
+	if report.Packets != 5 || report.Bytes != 500 || report.Lost != 1 || report.OutOfOrder != 1 {
+		t.Errorf("Expected 5 datagrams with 1 lost and 1 out of order but got %+v", report)
+	}
+	if report.JitterMs <= 0 || report.JitterMs >= 1 {
+		t.Errorf("Expected a jitter below 1ms but got %f", report.JitterMs)
+	}
+	if session.end(7) != report {
+		t.Errorf("Expected repeated end datagrams to get the same report")
+	}
+}
+
+func TestUDPNoServer(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %s", err)
+	}
+	address := conn.LocalAddr().String()
+	conn.Close()
+	_, err = UDP(context.Background(), UDPOptions{Address: address, Duration: 50 * time.Millisecond, Rate: 100000, Size: 100})
+	if err == nil {
+		t.Errorf("Expected an error without a report from the server")
+	}
+}
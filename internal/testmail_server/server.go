@@ -7,6 +7,7 @@ import (
 
 	"github.com/mxcd/go-config/config"
 	"github.com/mxcd/tester-toolbox/internal/mail"
+	"github.com/mxcd/tester-toolbox/internal/util"
 	"github.com/rs/zerolog/log"
 )
 
@@ -26,7 +27,11 @@ func StartServer() {
 	})
 
 	port := config.Get().Int("PORT")
-	portString := fmt.Sprintf(":%d", port)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port)}
+	err := util.ConfigureServerTimeouts(server)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid server timeout")
+	}
 	log.Info().Msgf("Starting server on port %d", port)
-	http.ListenAndServe(portString, nil)
+	server.ListenAndServe()
 }
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mxcd/go-config/config"
+)
+
+// GetDurationFromString parses a Go duration string such as "90s", "15m" or
+// "2h". Negative durations are rejected.
+func GetDurationFromString(durationStr string) (time.Duration, error) {
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s', use e.g. '90s', '15m' or '2h'", durationStr)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("duration '%s' must not be negative", durationStr)
+	}
+	return duration, nil
+}
+
+// GetDurationFromConfig parses the configuration value key as a duration.
+func GetDurationFromConfig(key string) (time.Duration, error) {
+	duration, err := GetDurationFromString(config.Get().String(key))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return duration, nil
+}
+
+// ServerTimeoutConfig returns the configuration values of the HTTP server
+// timeouts read by ConfigureServerTimeouts. A timeout of 0s disables it.
+func ServerTimeoutConfig() []config.Value {
+	return []config.Value{
+		config.String("READ_HEADER_TIMEOUT").NotEmpty().Default("10s"),
+		config.String("READ_TIMEOUT").NotEmpty().Default("0s"),
+		config.String("WRITE_TIMEOUT").NotEmpty().Default("0s"),
+		config.String("IDLE_TIMEOUT").NotEmpty().Default("2m"),
+	}
+}
+
+// ConfigureServerTimeouts applies the timeouts of ServerTimeoutConfig to server.
+func ConfigureServerTimeouts(server *http.Server) error {
+	timeouts := []struct {
+		key     string
+		timeout *time.Duration
+	}{
+		{"READ_HEADER_TIMEOUT", &server.ReadHeaderTimeout},
+		{"READ_TIMEOUT", &server.ReadTimeout},
+		{"WRITE_TIMEOUT", &server.WriteTimeout},
+		{"IDLE_TIMEOUT", &server.IdleTimeout},
+	}
+	for _, timeout := range timeouts {
+		duration, err := GetDurationFromConfig(timeout.key)
+		if err != nil {
+			return err
+		}
+		*timeout.timeout = duration
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDurationFromString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{"90s", 90 * time.Second, false},
+		{"15m", 15 * time.Minute, false},
+		{"2h", 2 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"250ms", 250 * time.Millisecond, false},
+		{"0s", 0, false},
+		{"-5s", 0, true},
+		{"60", 0, true},
+		{"invalid", 0, true},
+	}
+
+	for _, test := range tests {
+		result, err := GetDurationFromString(test.input)
+		if (err != nil) != test.err {
+			t.Errorf("Expected error %v for input '%s' but got %v", test.err, test.input, err)
+		}
+		if result != test.expected {
+			t.Errorf("Expected %s for input '%s' but got %s", test.expected, test.input, result)
+		}
+	}
+}
@@ -46,6 +46,17 @@ func GetByteSizeFromString(sizeStr string) (int64, error) {
 	}
 }
 
+// GetRateFromString parses a byte size per second such as "10MiB/s". The
+// "/s" is optional.
+func GetRateFromString(rateString string) (int64, error) {
+	trimmed := strings.TrimSuffix(strings.ToLower(rateString), "/s")
+	rate, err := GetByteSizeFromString(trimmed)
+	if err != nil || rate < 1 {
+		return 0, fmt.Errorf("invalid rate '%s', use e.g. '10MiB/s'", rateString)
+	}
+	return rate, nil
+}
+
 func GetStringFromByteSize(size int64) string {
 	if size < 1024 {
 		return fmt.Sprintf("%d B", size)
@@ -69,3 +69,26 @@ func TestGetStringFromByteSize(t *testing.T) {
 		}
 	}
 }
+
+func TestGetRateFromString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"10MiB/s", 10 * 1024 * 1024},
+		{"1.5kb/s", 1500},
+		{"100", 100},
+		{"0/s", 0},
+		{"fast", 0},
+	}
+
+	for _, test := range tests {
+		result, err := GetRateFromString(test.input)
+		if test.expected == 0 && err == nil {
+			t.Errorf("Expected an error for input %s", test.input)
+		}
+		if result != test.expected {
+			t.Errorf("Expected %d for input %s but got %d", test.expected, test.input, result)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package util
+
+import (
+	"math"
+	"sort"
+)
+
+// histogramGamma is the ratio between the bounds of consecutive buckets.
+// Reporting the middle of a bucket keeps the relative error below 0.5%.
+const histogramGamma = 1.01
+
+// zeroBucket collects all values that are zero or negative.
+const zeroBucket = math.MinInt32
+
+var histogramLogGamma = math.Log(histogramGamma)
+
+// Histogram is a sparse, log-bucketed histogram. Count, min, max, sum and
+// sum of squares are tracked exactly, percentiles are approximated from the
+// buckets. Histograms can be merged and serialized, which makes them
+// suitable for aggregating results of several test runners.
+// The zero value is an empty histogram ready to use.
+type Histogram struct {
+	Buckets    map[int32]uint64 `json:"buckets"`
+	Count      uint64           `json:"count"`
+	Min        float64          `json:"min"`
+	Max        float64          `json:"max"`
+	Sum        float64          `json:"sum"`
+	SumSquares float64          `json:"sumSquares"`
+}
+
+func histogramBucket(value float64) int32 {
+	if value <= 0 {
+		return zeroBucket
+	}
+	return int32(math.Floor(math.Log(value) / histogramLogGamma))
+}
+
+func histogramBucketValue(bucket int32) float64 {
+	if bucket == zeroBucket {
+		return 0
+	}
+	return 2 * math.Pow(histogramGamma, float64(bucket)) * histogramGamma / (histogramGamma + 1)
+}
+
+func (h *Histogram) Record(value float64) {
+	if h.Buckets == nil {
+		h.Buckets = make(map[int32]uint64)
+	}
+	if h.Count == 0 || value < h.Min {
+		h.Min = value
+	}
+	if h.Count == 0 || value > h.Max {
+		h.Max = value
+	}
+	h.Buckets[histogramBucket(value)]++
+	h.Count++
+	h.Sum += value
+	h.SumSquares += value * value
+}
+
+// Merge adds all values recorded in other to the histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.Count == 0 {
+		return
+	}
+	if h.Buckets == nil {
+		h.Buckets = make(map[int32]uint64, len(other.Buckets))
+	}
+	if h.Count == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if h.Count == 0 || other.Max > h.Max {
+		h.Max = other.Max
+	}
+	for bucket, count := range other.Buckets {
+		h.Buckets[bucket] += count
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.SumSquares += other.SumSquares
+}
+
+// Percentile returns the approximate value below which p percent of the recorded values fall.
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	if p >= 100 {
+		return h.Max
+	}
+	buckets := h.sortedBuckets()
+	rank := uint64(math.Ceil(p / 100 * float64(h.Count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for _, bucket := range buckets {
+		seen += h.Buckets[bucket]
+		if seen >= rank {
+			return math.Min(math.Max(histogramBucketValue(bucket), h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// StdDev returns the population standard deviation of the recorded values.
+func (h *Histogram) StdDev() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	variance := h.SumSquares/float64(h.Count) - mean*mean
+	if variance < 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// HistogramBin counts the recorded values between Lower and Upper.
+type HistogramBin struct {
+	Lower float64
+	Upper float64
+	Count uint64
+}
+
+// Bins regroups the recorded values into count logarithmically spaced bins
+// between the minimum and the maximum, e.g. for plotting. Values of zero or
+// below fall into the first bin.
+func (h *Histogram) Bins(count int) []HistogramBin {
+	if h.Count == 0 || count < 1 {
+		return nil
+	}
+	lower := h.Min
+	if lower <= 0 {
+		lower = math.Min(histogramBucketValue(h.smallestPositiveBucket()), h.Max)
+	}
+	if lower <= 0 || h.Max <= lower {
+		return []HistogramBin{{Lower: h.Min, Upper: h.Max, Count: h.Count}}
+	}
+
+	ratio := math.Log(h.Max / lower)
+	bins := make([]HistogramBin, count)
+	for i := range bins {
+		bins[i].Lower = lower * math.Exp(ratio*float64(i)/float64(count))
+		bins[i].Upper = lower * math.Exp(ratio*float64(i+1)/float64(count))
+	}
+	for bucket, bucketCount := range h.Buckets {
+		index := 0
+		if value := histogramBucketValue(bucket); value > lower {
+			index = int(math.Log(value/lower) / ratio * float64(count))
+		}
+		if index >= count {
+			index = count - 1
+		}
+		bins[index].Count += bucketCount
+	}
+	bins[0].Lower = h.Min
+	return bins
+}
+
+func (h *Histogram) smallestPositiveBucket() int32 {
+	smallest := int32(math.MaxInt32)
+	for bucket := range h.Buckets {
+		if bucket != zeroBucket && bucket < smallest {
+			smallest = bucket
+		}
+	}
+	return smallest
+}
+
+func (h *Histogram) sortedBuckets() []int32 {
+	buckets := make([]int32, 0, len(h.Buckets))
+	for bucket := range h.Buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return buckets
+}
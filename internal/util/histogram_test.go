@@ -0,0 +1,151 @@
+package util
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	samples := make([]float64, 0, 10000)
+	histogram := Histogram{}
+	for i := 0; i < 10000; i++ {
+		value := math.Exp(r.NormFloat64()) * 100
+		samples = append(samples, value)
+		histogram.Record(value)
+	}
+
+	if histogram.Count != 10000 {
+		t.Errorf("Expected count 10000 but got %d", histogram.Count)
+	}
+	if histogram.Min != GetMinFloat64(samples) || histogram.Max != GetMaxFloat64(samples) {
+		t.Errorf("Expected exact min and max")
+	}
+	if math.Abs(histogram.Mean()-GetMean(samples)) > 1e-6 {
+		t.Errorf("Expected mean %f but got %f", GetMean(samples), histogram.Mean())
+	}
+	if math.Abs(histogram.StdDev()-GetStdDevFloat64(samples)) > 1e-6 {
+		t.Errorf("Expected standard deviation %f but got %f", GetStdDevFloat64(samples), histogram.StdDev())
+	}
+	for _, p := range []float64{1, 10, 50, 90, 99, 100} {
+		expected := GetPercentileFloat64(samples, p)
+		actual := histogram.Percentile(p)
+		if math.Abs(actual-expected)/expected > 0.01 {
+			t.Errorf("Expected P%.0f close to %f but got %f", p, expected, actual)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	first := Histogram{}
+	second := Histogram{}
+	combined := Histogram{}
+	for i := 1; i <= 1000; i++ {
+		if i%3 == 0 {
+			first.Record(float64(i))
+		} else {
+			second.Record(float64(i))
+		}
+		combined.Record(float64(i))
+	}
+
+	merged := Histogram{}
+	merged.Merge(&first)
+	merged.Merge(&second)
+	merged.Merge(&Histogram{})
+
+	if merged.Count != combined.Count || merged.Min != 1 || merged.Max != 1000 || merged.Sum != combined.Sum {
+		t.Errorf("Expected merged histogram to match combined histogram")
+	}
+	if merged.Percentile(50) != combined.Percentile(50) {
+		t.Errorf("Expected merged P50 %f but got %f", combined.Percentile(50), merged.Percentile(50))
+	}
+}
+
+func TestHistogramEdgeCases(t *testing.T) {
+	empty := Histogram{}
+	if empty.Percentile(50) != 0 || empty.Mean() != 0 || empty.StdDev() != 0 {
+		t.Errorf("Expected zero statistics for an empty histogram")
+	}
+
+	zeros := Histogram{}
+	zeros.Record(0)
+	zeros.Record(0)
+	zeros.Record(5)
+	if zeros.Percentile(50) != 0 {
+		t.Errorf("Expected P50 of 0 but got %f", zeros.Percentile(50))
+	}
+	if zeros.Percentile(100) != 5 {
+		t.Errorf("Expected P100 of 5 but got %f", zeros.Percentile(100))
+	}
+
+	data, err := json.Marshal(&zeros)
+	if err != nil {
+		t.Fatalf("Failed to marshal histogram: %s", err)
+	}
+	decoded := Histogram{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal histogram: %s", err)
+	}
+	if decoded.Count != 3 || decoded.Percentile(100) != 5 {
+		t.Errorf("Expected histogram to survive a JSON round trip")
+	}
+}
+
+func TestHistogramBins(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	histogram := Histogram{}
+	below := 0
+	for i := 0; i < 10000; i++ {
+		value := math.Exp(r.NormFloat64()) * 100
+		if value < 100 {
+			below++
+		}
+		histogram.Record(value)
+	}
+
+	bins := histogram.Bins(50)
+	if len(bins) != 50 {
+		t.Fatalf("Expected 50 bins but got %d", len(bins))
+	}
+	if bins[0].Lower != histogram.Min || math.Abs(bins[49].Upper-histogram.Max) > 1e-9*histogram.Max {
+		t.Errorf("Expected the bins to span min to max")
+	}
+	var total, counted, straddling uint64
+	for i, bin := range bins {
+		total += bin.Count
+		if bin.Upper <= 100 {
+			counted += bin.Count
+		} else if bin.Lower < 100 {
+			straddling = bin.Count
+		}
+		if i > 0 && bin.Lower != bins[i-1].Upper {
+			t.Errorf("Expected bin %d to start where the previous one ends", i)
+		}
+	}
+	if total != histogram.Count {
+		t.Errorf("Expected %d values in the bins but got %d", histogram.Count, total)
+	}
+	if counted > uint64(below) || counted+straddling < uint64(below) {
+		t.Errorf("Expected %d values below 100 but the bins hold %d to %d", below, counted, counted+straddling)
+	}
+
+	single := Histogram{}
+	single.Record(5)
+	single.Record(5)
+	if bins := single.Bins(10); len(bins) != 1 || bins[0].Count != 2 {
+		t.Errorf("Expected a single bin for identical values but got %v", bins)
+	}
+	zero := Histogram{}
+	zero.Record(0)
+	zero.Record(1)
+	zero.Record(10)
+	if bins := zero.Bins(10); bins[0].Lower != 0 || bins[0].Count != 2 || bins[9].Count != 1 {
+		t.Errorf("Expected 0 and 1 in the first and 10 in the last bin but got %v", bins)
+	}
+	if bins := (&Histogram{}).Bins(10); bins != nil {
+		t.Errorf("Expected no bins for an empty histogram")
+	}
+}
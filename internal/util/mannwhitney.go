@@ -0,0 +1,58 @@
+package util
+
+import (
+	"math"
+	"sort"
+)
+
+// MannWhitneyU runs a two-sided Mann-Whitney U test on the values recorded
+// in two histograms. Values in the same bucket are treated as ties, which
+// loses no more precision than the histograms themselves. It returns the U
+// statistic of a and the p-value of the normal approximation with tie and
+// continuity correction. The p-value is 1 if either histogram is empty.
+func MannWhitneyU(a *Histogram, b *Histogram) (float64, float64) {
+	if a.Count == 0 || b.Count == 0 {
+		return 0, 1
+	}
+
+	bucketSet := make(map[int32]bool, len(a.Buckets)+len(b.Buckets))
+	for bucket := range a.Buckets {
+		bucketSet[bucket] = true
+	}
+	for bucket := range b.Buckets {
+		bucketSet[bucket] = true
+	}
+	buckets := make([]int32, 0, len(bucketSet))
+	for bucket := range bucketSet {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	n1 := float64(a.Count)
+	n2 := float64(b.Count)
+	n := n1 + n2
+
+	// every bucket is a group of ties that shares the mean rank of the group
+	var rankSum, tieSum, seen float64
+	for _, bucket := range buckets {
+		countA := float64(a.Buckets[bucket])
+		ties := countA + float64(b.Buckets[bucket])
+		rankSum += countA * (seen + (ties+1)/2)
+		tieSum += ties*ties*ties - ties
+		seen += ties
+	}
+
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieSum/(n*(n-1)))
+	if variance <= 0 {
+		return u, 1
+	}
+
+	z := math.Abs(u-mean) - 0.5
+	if z < 0 {
+		z = 0
+	}
+	z /= math.Sqrt(variance)
+	return u, math.Erfc(z / math.Sqrt2)
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	a := Histogram{}
+	b := Histogram{}
+	for i := 1; i <= 5; i++ {
+		a.Record(float64(i))
+		b.Record(float64(i + 5))
+	}
+	u, p := MannWhitneyU(&a, &b)
+	if u != 0 {
+		t.Errorf("Expected U 0 for disjoint samples but got %f", u)
+	}
+	if math.Abs(p-0.01219) > 0.0001 {
+		t.Errorf("Expected p-value 0.01219 but got %f", p)
+	}
+
+	_, p = MannWhitneyU(&a, &a)
+	if p != 1 {
+		t.Errorf("Expected p-value 1 for identical samples but got %f", p)
+	}
+	_, p = MannWhitneyU(&a, &Histogram{})
+	if p != 1 {
+		t.Errorf("Expected p-value 1 for an empty sample but got %f", p)
+	}
+}
+
+func TestMannWhitneyUShift(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	baseline := Histogram{}
+	same := Histogram{}
+	shifted := Histogram{}
+	for i := 0; i < 2000; i++ {
+		baseline.Record(math.Exp(r.NormFloat64()) * 100)
+		same.Record(math.Exp(r.NormFloat64()) * 100)
+		shifted.Record(math.Exp(r.NormFloat64()) * 120)
+	}
+
+	_, p := MannWhitneyU(&baseline, &same)
+	if p < 0.05 {
+		t.Errorf("Expected no significant difference between samples of one distribution but got p-value %f", p)
+	}
+	_, p = MannWhitneyU(&baseline, &shifted)
+	if p > 0.001 {
+		t.Errorf("Expected a significant difference for a 20%% shift but got p-value %f", p)
+	}
+}
@@ -0,0 +1,177 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxObjectSize is the largest object S3 accepts. Larger sizes are rejected
+// and log-normal samples are capped to it.
+const MaxObjectSize int64 = 5 * 1024 * 1024 * 1024 * 1024
+
+type sizeDistributionKind int
+
+const (
+	sizeDistributionWeighted sizeDistributionKind = iota
+	sizeDistributionUniform
+	sizeDistributionLogNormal
+)
+
+// SizeDistribution describes the object sizes of a test run. It is either a
+// weighted list of fixed sizes (a single size being the simplest case), a
+// uniform range or a log-normal distribution.
+type SizeDistribution struct {
+	kind    sizeDistributionKind
+	sizes   []int64
+	weights []float64
+	min     int64
+	max     int64
+	median  int64
+	sigma   float64
+	source  string
+}
+
+// ParseSizeDistribution parses one of the following formats:
+//
+//	500KiB                      a single size
+//	4KiB:60,1MiB:30,64MiB:10    fixed sizes with relative weights
+//	1KiB-10MiB                  uniformly distributed between both sizes
+//	lognormal:1MiB,1.5          log-normal with the given median and sigma
+func ParseSizeDistribution(distributionStr string) (*SizeDistribution, error) {
+	distributionStr = strings.TrimSpace(distributionStr)
+	switch {
+	case strings.HasPrefix(strings.ToLower(distributionStr), "lognormal:"):
+		return parseLogNormalDistribution(distributionStr)
+	case strings.Contains(distributionStr, "-"):
+		return parseUniformDistribution(distributionStr)
+	default:
+		return parseWeightedDistribution(distributionStr)
+	}
+}
+
+func parseWeightedDistribution(distributionStr string) (*SizeDistribution, error) {
+	distribution := &SizeDistribution{kind: sizeDistributionWeighted, source: distributionStr}
+	weightSum := 0.0
+	for _, part := range strings.Split(distributionStr, ",") {
+		sizeStr, weightStr, hasWeight := strings.Cut(strings.TrimSpace(part), ":")
+		size, err := GetByteSizeFromString(sizeStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size '%s': %w", sizeStr, err)
+		}
+		if size <= 0 || size > MaxObjectSize {
+			return nil, fmt.Errorf("size '%s' must be positive and at most 5TiB", sizeStr)
+		}
+		weight := 1.0
+		if hasWeight {
+			weight, err = strconv.ParseFloat(weightStr, 64)
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("invalid weight '%s' for size '%s'", weightStr, sizeStr)
+			}
+		}
+		weightSum += weight
+		distribution.sizes = append(distribution.sizes, size)
+		distribution.weights = append(distribution.weights, weightSum)
+	}
+	for i := range distribution.weights {
+		distribution.weights[i] /= weightSum
+	}
+	return distribution, nil
+}
+
+func parseUniformDistribution(distributionStr string) (*SizeDistribution, error) {
+	minStr, maxStr, _ := strings.Cut(distributionStr, "-")
+	min, err := GetByteSizeFromString(strings.TrimSpace(minStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid lower bound '%s': %w", minStr, err)
+	}
+	max, err := GetByteSizeFromString(strings.TrimSpace(maxStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid upper bound '%s': %w", maxStr, err)
+	}
+	if min <= 0 || max < min || max > MaxObjectSize {
+		return nil, fmt.Errorf("invalid range '%s': bounds must be positive, ascending and at most 5TiB", distributionStr)
+	}
+	return &SizeDistribution{kind: sizeDistributionUniform, min: min, max: max, source: distributionStr}, nil
+}
+
+func parseLogNormalDistribution(distributionStr string) (*SizeDistribution, error) {
+	parameters := strings.Split(distributionStr[len("lognormal:"):], ",")
+	if len(parameters) != 2 {
+		return nil, fmt.Errorf("log-normal distribution needs a median and a sigma, e.g. 'lognormal:1MiB,1.5'")
+	}
+	median, err := GetByteSizeFromString(strings.TrimSpace(parameters[0]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid median '%s': %w", parameters[0], err)
+	}
+	sigma, err := strconv.ParseFloat(strings.TrimSpace(parameters[1]), 64)
+	if err != nil || sigma < 0 {
+		return nil, fmt.Errorf("invalid sigma '%s'", parameters[1])
+	}
+	if median <= 0 || median > MaxObjectSize {
+		return nil, fmt.Errorf("median '%s' must be positive and at most 5TiB", parameters[0])
+	}
+	return &SizeDistribution{kind: sizeDistributionLogNormal, median: median, sigma: sigma, source: distributionStr}, nil
+}
+
+// Sample draws a size from the distribution. The result is always at least
+// one byte and at most MaxObjectSize.
+func (d *SizeDistribution) Sample(r *rand.Rand) int64 {
+	var size int64
+	switch d.kind {
+	case sizeDistributionUniform:
+		size = d.min + r.Int63n(d.max-d.min+1)
+	case sizeDistributionLogNormal:
+		// the tail of a large sigma exceeds int64, so cap before converting
+		sample := float64(d.median) * math.Exp(r.NormFloat64()*d.sigma)
+		size = int64(math.Min(sample, float64(MaxObjectSize)))
+	default:
+		p := r.Float64()
+		index := sort.SearchFloat64s(d.weights, p)
+		if index >= len(d.sizes) {
+			index = len(d.sizes) - 1
+		}
+		size = d.sizes[index]
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// SizeClass returns the lower bound of the class a size is reported in.
+// Weighted distributions report every configured size as its own class,
+// continuous distributions group sizes into power-of-two classes.
+func (d *SizeDistribution) SizeClass(size int64) int64 {
+	if d.kind == sizeDistributionWeighted {
+		return size
+	}
+	if size < 1 {
+		return 0
+	}
+	return int64(1) << (63 - bits.LeadingZeros64(uint64(size)))
+}
+
+// SizeClassLabel formats a class as returned by SizeClass for reports.
+func (d *SizeDistribution) SizeClassLabel(class int64) string {
+	if d.kind == sizeDistributionWeighted {
+		return GetStringFromByteSize(class)
+	}
+	return fmt.Sprintf("%s - %s", GetStringFromByteSize(class), GetStringFromByteSize(class*2))
+}
+
+// IsSingleSize reports whether the distribution always yields the same size.
+func (d *SizeDistribution) IsSingleSize() bool {
+	return d.kind == sizeDistributionWeighted && len(d.sizes) == 1
+}
+
+func (d *SizeDistribution) String() string {
+	if d.IsSingleSize() {
+		return GetStringFromByteSize(d.sizes[0])
+	}
+	return d.source
+}
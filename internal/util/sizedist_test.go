@@ -0,0 +1,128 @@
+package util
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestParseSizeDistribution(t *testing.T) {
+	tests := []struct {
+		input string
+		err   bool
+	}{
+		{"500KiB", false},
+		{"4KiB:60,1MiB:30,64MiB:10", false},
+		{"4KiB,1MiB", false},
+		{"1KiB-10MiB", false},
+		{"lognormal:1MiB,1.5", false},
+		{"", true},
+		{"4KiB:abc", true},
+		{"4KiB:-1", true},
+		{"10MiB-1KiB", true},
+		{"1KiB-", true},
+		{"lognormal:1MiB", true},
+		{"lognormal:1MiB,x", true},
+		{"6TiB", true},
+		{"1KiB-6TiB", true},
+		{"lognormal:6TiB,1", true},
+	}
+
+	for _, test := range tests {
+		_, err := ParseSizeDistribution(test.input)
+		if test.err && err == nil {
+			t.Errorf("Expected an error for input %s but got none", test.input)
+		}
+		if !test.err && err != nil {
+			t.Errorf("Expected no error for input %s but got %s", test.input, err)
+		}
+	}
+}
+
+func TestSizeDistributionSample(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	single, _ := ParseSizeDistribution("500KiB")
+	if !single.IsSingleSize() {
+		t.Errorf("Expected 500KiB to be a single size")
+	}
+	if size := single.Sample(r); size != 500*1024 {
+		t.Errorf("Expected %d for single size but got %d", 500*1024, size)
+	}
+
+	weighted, _ := ParseSizeDistribution("4KiB:60,1MiB:30,64MiB:10")
+	counts := map[int64]int{}
+	for i := 0; i < 10000; i++ {
+		counts[weighted.Sample(r)]++
+	}
+	if len(counts) != 3 {
+		t.Errorf("Expected 3 distinct sizes but got %d", len(counts))
+	}
+	if counts[4*1024] < 5500 || counts[4*1024] > 6500 {
+		t.Errorf("Expected about 6000 samples of 4KiB but got %d", counts[4*1024])
+	}
+
+	uniform, _ := ParseSizeDistribution("1KiB-10MiB")
+	for i := 0; i < 1000; i++ {
+		size := uniform.Sample(r)
+		if size < 1024 || size > 10*1024*1024 {
+			t.Errorf("Expected uniform sample within bounds but got %d", size)
+		}
+	}
+
+	logNormal, _ := ParseSizeDistribution("lognormal:1MiB,1")
+	below := 0
+	for i := 0; i < 10000; i++ {
+		if logNormal.Sample(r) < 1024*1024 {
+			below++
+		}
+	}
+	if below < 4500 || below > 5500 {
+		t.Errorf("Expected about half of the log-normal samples below the median but got %d", below)
+	}
+
+	wide, _ := ParseSizeDistribution("lognormal:1GiB,40")
+	capped := 0
+	for i := 0; i < 10000; i++ {
+		size := wide.Sample(r)
+		if size < 1 || size > MaxObjectSize {
+			t.Fatalf("Expected a sample between 1 byte and 5TiB but got %d", size)
+		}
+		if size == MaxObjectSize {
+			capped++
+		}
+	}
+	// with a sigma of 40 almost half of the samples exceed 5TiB
+	if capped < 4000 {
+		t.Errorf("Expected many samples to be capped at 5TiB but got %d", capped)
+	}
+}
+
+func TestSizeClass(t *testing.T) {
+	weighted, _ := ParseSizeDistribution("4KiB:60,1MiB:40")
+	if class := weighted.SizeClass(4096); class != 4096 {
+		t.Errorf("Expected weighted size class 4096 but got %d", class)
+	}
+	if label := weighted.SizeClassLabel(4096); label != "4.00 KiB" {
+		t.Errorf("Expected weighted size class label '4.00 KiB' but got '%s'", label)
+	}
+
+	uniform, _ := ParseSizeDistribution("1KiB-10MiB")
+	tests := []struct {
+		input    int64
+		expected int64
+	}{
+		{1, 1},
+		{1024, 1024},
+		{2047, 1024},
+		{3 * 1024 * 1024, 2 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		if class := uniform.SizeClass(test.input); class != test.expected {
+			t.Errorf("Expected size class %d for input %d but got %d", test.expected, test.input, class)
+		}
+	}
+	if label := uniform.SizeClassLabel(1024); label != "1.00 KiB - 2.00 KiB" {
+		t.Errorf("Expected size class label '1.00 KiB - 2.00 KiB' but got '%s'", label)
+	}
+
+}
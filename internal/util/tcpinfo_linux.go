@@ -0,0 +1,31 @@
+//go:build linux
+
+package util
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// TCPRetransmits returns the number of segments the kernel retransmitted on
+// conn. ok is false if conn is no TCP connection or the platform does not
+// expose the counter.
+func TCPRetransmits(conn net.Conn) (retransmits uint32, ok bool) {
+	tcpConn, isTCP := conn.(*net.TCPConn)
+	if !isTCP {
+		return 0, false
+	}
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	var info *unix.TCPInfo
+	controlErr := raw.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if controlErr != nil || err != nil {
+		return 0, false
+	}
+	return info.Total_retrans, true
+}
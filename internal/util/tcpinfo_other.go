@@ -0,0 +1,10 @@
+//go:build !linux
+
+package util
+
+import "net"
+
+// TCPRetransmits is only supported on Linux.
+func TCPRetransmits(conn net.Conn) (retransmits uint32, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"time"
+)
+
+// Throttle paces a transfer to rate bytes per second since its first chunk.
+type Throttle struct {
+	rate  int64
+	start time.Time
+	total int64
+}
+
+func NewThrottle(rate int64) *Throttle {
+	return &Throttle{rate: rate}
+}
+
+// ChunkSize is the size of the chunks to transfer at a time. Chunks of
+// 100ms worth of data keep the rate smooth.
+func (t *Throttle) ChunkSize() int {
+	chunk := t.rate / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	return int(chunk)
+}
+
+// Start marks the beginning of the transfer. It is called by Transferred
+// if it has not been called before.
+func (t *Throttle) Start() {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+}
+
+// Transferred records n transferred bytes and returns how long to wait
+// before the next chunk to stay at the rate.
+func (t *Throttle) Transferred(n int) time.Duration {
+	t.Start()
+	t.total += int64(n)
+	expected := time.Duration(float64(t.total) / float64(t.rate) * float64(time.Second))
+	return expected - time.Since(t.start)
+}
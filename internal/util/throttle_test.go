@@ -0,0 +1,26 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	throttle := NewThrottle(1000)
+	if throttle.ChunkSize() != 100 {
+		t.Errorf("Expected chunks of 100ms worth of data but got %d bytes", throttle.ChunkSize())
+	}
+	if NewThrottle(5).ChunkSize() != 1 {
+		t.Errorf("Expected chunks of at least one byte")
+	}
+
+	throttle.Start()
+	wait := throttle.Transferred(500)
+	if wait < 450*time.Millisecond || wait > 500*time.Millisecond {
+		t.Errorf("Expected to wait about 500ms after 500 bytes at 1000 bytes per second but got %s", wait)
+	}
+	throttle.start = throttle.start.Add(-2 * time.Second)
+	if wait := throttle.Transferred(500); wait > 0 {
+		t.Errorf("Expected no wait for a transfer behind its rate but got %s", wait)
+	}
+}